@@ -0,0 +1,164 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Exit codes shared by the subcommands
+const (
+	// exitError reports a failure at run time, such as an unreadable file or
+	// a model that does not load
+	exitError = 1
+	// exitUsage reports bad flags or arguments, as flag.ExitOnError does
+	exitUsage = 2
+)
+
+// command is a subcommand of the command line tool
+type command struct {
+	name string
+	// args is the synopsis after the command name
+	args string
+	// summary is the one line description in the command list
+	summary string
+	// help is the longer description printed by the command's -h
+	help string
+	run  func(args []string)
+}
+
+// commands lists the subcommands in the order "goahmedfrasa help" shows them.
+// It is filled in by init to break the reference cycle with runHelp.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"segment", "[flags]", "Segment text into prefixes, stem and suffixes (the default)",
+			"Segments every line of the input and prints the words with their morphemes joined\n" +
+				"by \"+\". This is also what goahmedfrasa does when given only flags. Run\n" +
+				"\"goahmedfrasa help\" for the other commands.", runSegment},
+		{"stem", "[flags]", "Print the stem of every word",
+			"Segments every line of the input and prints the stem of every word.", runStem},
+		{"root", "[flags]", "Print the root of every word",
+			"Segments every line of the input and prints the root of the stem of every word,\n" +
+				"as matched by its template. Words whose stem fits no template print their stem.", runRoot},
+		{"template", "[flags]", "Print the morphological template of every word",
+			"Segments every line of the input and prints the template of the stem of every\n" +
+				"word in Buckwalter letters, where f, E and l stand for the root letters and Y\n" +
+				"means no template fits.", runTemplate},
+		{"normalize", "[flags]", "Normalize Arabic text",
+			"Prints every word of the input normalized as in the segmented output: alef and\n" +
+				"hamza forms unified, ta marbouta turned into heh, diacritics removed.", runNormalize},
+		{"translit", "[flags]", "Transliterate between Arabic and Buckwalter",
+			"Converts the input from Arabic letters to Buckwalter transliteration, or back\n" +
+				"with -to arabic.", runTranslit},
+		{"explain", "[flags] [words...]", "Show the score breakdown of the candidates of words",
+			"Prints the score breakdown of the candidates of every word given as an argument\n" +
+				"or, without arguments, of every word read from stdin.", runExplain},
+		{"repl", "[flags]", "Segment words interactively",
+			"Loads the model once and segments the words typed on stdin, in Arabic or\n" +
+				"Buckwalter, printing the results in both. Commands such as :nbest 5, :explain,\n" +
+				":template, :scheme atb and :norm off change what is shown; :help lists them.\n" +
+				"Inputs are kept in a history file and can be repeated with !N.", runREPL},
+		{"eval", "-i gold.txt [flags]", "Measure segmentation accuracy on a gold corpus",
+			"Segments every word of a gold segmented corpus and prints the fraction segmented\n" +
+				"exactly like the gold, after normalization.", runEval},
+		{"train", "-i gold.txt [flags]", "Train scoring weights on a gold corpus",
+			"Learns the scoring weights from a gold segmented corpus with an averaged\n" +
+				"perceptron, fits the n-best temperature, or exports the candidate features.", runTrain},
+		{"convert-data", "[flags]", "Convert the JSON dictionaries into a binary model file",
+			"Converts the JSON dictionaries of a data directory into one binary model file,\n" +
+				"which loads faster and can be memory-mapped with -m.", runConvertData},
+		{"serve", "[flags]", "Serve segmentation over HTTP",
+			"Loads the model once and serves the HTTP JSON endpoints until interrupted. The\n" +
+				"health endpoints answer while the model is still loading.", runServe},
+		{"daemon", "[flags]", "Serve segmentation over a Unix socket for -socket clients",
+			"Keeps the model loaded and segments the text of clients connecting to a Unix\n" +
+				"socket, such as \"goahmedfrasa -socket\", until interrupted.", runDaemon},
+		{"rpc", "[flags]", "Answer JSON-RPC 2.0 requests on stdin",
+			"Loads the model and answers line-delimited JSON-RPC 2.0 requests on stdin with\n" +
+				"responses on stdout until stdin ends.", runRPC},
+		{"help", "[command]", "Show the commands or the flags of one", "", runHelp},
+	}
+}
+
+// findCommand returns the subcommand called name, or nil
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// flagSet returns the flag set of the command, whose -h prints the command's
+// help text and flags
+func (c *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ExitOnError)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: goahmedfrasa %s %s\n\n%s\n", c.name, c.args, c.help)
+		if hasFlags(fs) {
+			fmt.Fprintln(out, "\nFlags:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+	n := 0
+	fs.VisitAll(func(*flag.Flag) { n++ })
+	return n > 0
+}
+
+// newFlagSet returns the flag set of the subcommand called name
+func newFlagSet(name string) *flag.FlagSet {
+	return findCommand(name).flagSet()
+}
+
+// printCommands writes the list of subcommands to w
+func printCommands(w io.Writer) {
+	fmt.Fprintln(w, "Usage: goahmedfrasa <command> [flags]")
+	fmt.Fprintln(w, "       goahmedfrasa [segment flags]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-13s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w, "\nRun \"goahmedfrasa help <command>\" or \"goahmedfrasa <command> -h\" for its flags.")
+}
+
+// runHelp implements "goahmedfrasa help [command]"
+func runHelp(args []string) {
+	if len(args) == 0 || args[0] == "help" || strings.HasPrefix(args[0], "-") {
+		printCommands(os.Stdout)
+		return
+	}
+	c := findCommand(args[0])
+	if c == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+		printCommands(os.Stderr)
+		os.Exit(exitUsage)
+	}
+	c.run([]string{"-h"})
+}
+
+// dispatch runs the subcommand named by args[0]. Arguments that start with a
+// flag, and no arguments at all, run segment, as before there were
+// subcommands.
+func dispatch(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		runSegment(args)
+		return
+	}
+	c := findCommand(args[0])
+	if c == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+		printCommands(os.Stderr)
+		os.Exit(exitUsage)
+	}
+	c.run(args[1:])
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"goahmedfrasa/pkg/goahmedfrasa"
+)
+
+// runConvertData implements "goahmedfrasa convert-data [flags]", which writes
+// the dictionaries of a data directory into one binary model file
+func runConvertData(args []string) {
+	fs := newFlagSet("convert-data")
+	dataDir := fs.String("d", "data/", "Data directory holding the JSON dictionaries")
+	outputFile := fs.String("o", "goahmedfrasa.model", "Output binary model path")
+	fs.Parse(args)
+
+	dir := *dataDir
+	if !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+
+	out, err := os.Create(*outputFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+		os.Exit(exitError)
+	}
+	writer := bufio.NewWriter(out)
+	if err := goahmedfrasa.ConvertData(dir, writer); err != nil {
+		fmt.Fprintf(os.Stderr, "Error converting data: %v\n", err)
+		os.Exit(exitError)
+	}
+	if err := writer.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing model: %v\n", err)
+		os.Exit(exitError)
+	}
+	if err := out.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing model: %v\n", err)
+		os.Exit(exitError)
+	}
+}
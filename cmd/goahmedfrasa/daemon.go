@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
+
+	"goahmedfrasa/pkg/goahmedfrasa"
+)
+
+// Daemon protocol
+//
+// A client connects to the Unix socket and sends a daemonRequest as one line
+// of JSON. The daemon answers with a daemonResponse as one line of JSON, and
+// closes the connection if it refuses the request. Otherwise the client sends
+// the text to segment and closes its side of the connection for writing, and
+// the daemon answers with exactly what the command line tool would print for
+// that text before closing the connection.
+
+// daemonRequest carries the output options of a client and the model settings
+// it was given
+type daemonRequest struct {
+	Scheme    string      `json:"scheme"`
+	Normalize bool        `json:"normalize"`
+	NBest     int         `json:"nbest"`
+	Model     daemonModel `json:"model"`
+}
+
+// daemonResponse tells the client whether the daemon serves its request
+type daemonResponse struct {
+	Error string `json:"error,omitempty"`
+}
+
+// daemonModel holds the model settings of a daemon, or those given on the
+// command line of a client, which must match the daemon's. -m is left out as
+// it does not change the results.
+type daemonModel struct {
+	// Data is the absolute path of the data directory or model file, empty
+	// for the embedded dictionaries
+	Data         *string   `json:"data,omitempty"`
+	Weights      []float64 `json:"weights,omitempty"`
+	Temperature  *float64  `json:"temperature,omitempty"`
+	ValidAffixes *bool     `json:"validAffixes,omitempty"`
+}
+
+// clientModel returns the model settings set on the command line of fs
+func (m *modelFlags) clientModel(fs *flag.FlagSet) (daemonModel, error) {
+	var dm daemonModel
+	var err error
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "d":
+			if m.dataDir != "" {
+				var abs string
+				abs, err = filepath.Abs(m.dataDir)
+				dm.Data = &abs
+			}
+		case "w":
+			dm.Weights = goahmedfrasa.DefaultWeights()
+			if m.weightsFile != "" {
+				dm.Weights, err = goahmedfrasa.LoadWeights(m.weightsFile)
+			}
+		case "t":
+			dm.Temperature = &m.temperature
+		case "valid-affixes":
+			dm.ValidAffixes = &m.validAffixes
+		}
+	})
+	return dm, err
+}
+
+// daemonModel returns the settings of nbt, loaded with m
+func (m *modelFlags) daemonModel(nbt *goahmedfrasa.Farasa) (daemonModel, error) {
+	dir, embedded := m.source()
+	if !embedded {
+		var err error
+		if dir, err = filepath.Abs(dir); err != nil {
+			return daemonModel{}, err
+		}
+	}
+	return daemonModel{
+		Data:         &dir,
+		Weights:      nbt.Weights(),
+		Temperature:  &m.temperature,
+		ValidAffixes: &m.validAffixes,
+	}, nil
+}
+
+// check returns an error naming the first setting of client, a client's
+// settings, that differs from dm, the daemon's
+func (dm daemonModel) check(client daemonModel) error {
+	switch {
+	case client.Data != nil && *client.Data != *dm.Data:
+		loaded := *dm.Data
+		if loaded == "" {
+			loaded = "the embedded dictionaries"
+		}
+		return fmt.Errorf("the daemon loaded %s, not %s", loaded, *client.Data)
+	case client.Weights != nil && !slices.Equal(client.Weights, dm.Weights):
+		return errors.New("the daemon uses other scoring weights than -w")
+	case client.Temperature != nil && *client.Temperature != *dm.Temperature:
+		return fmt.Errorf("the daemon uses temperature %g, not %g", *dm.Temperature, *client.Temperature)
+	case client.ValidAffixes != nil && *client.ValidAffixes != *dm.ValidAffixes:
+		return fmt.Errorf("the daemon runs with -valid-affixes=%t", *dm.ValidAffixes)
+	}
+	return nil
+}
+
+// format returns the format function of processLines for the request
+func (req daemonRequest) format(nbt *goahmedfrasa.Farasa) func(string, *bytes.Buffer) int {
+	opts := goahmedfrasa.SegmentOptions{Scheme: req.Scheme, NoNormalize: !req.Normalize}
+	if req.NBest > 0 {
+		return nbestLine(nbt, req.NBest, opts)
+	}
+	return segmentLine(nbt, opts)
+}
+
+// runDaemon implements "goahmedfrasa daemon [flags]", which keeps the model
+// loaded and segments the text of clients connecting to a Unix socket until
+// interrupted
+func runDaemon(args []string) {
+	fs := newFlagSet("daemon")
+	var model modelFlags
+	model.register(fs)
+	socket := fs.String("socket", defaultSocket(), "Unix socket path to listen on")
+	jobs := fs.Int("j", 1, "Number of lines of a client segmented in parallel")
+	fs.Parse(args)
+
+	// a socket file left behind by a daemon that died is removed, a socket
+	// some daemon still listens on is not
+	if conn, err := net.Dial("unix", *socket); err == nil {
+		conn.Close()
+		fmt.Fprintf(os.Stderr, "A daemon is already listening on %s\n", *socket)
+		os.Exit(exitError)
+	}
+	nbt, err := model.load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing Farasa: %v\n", err)
+		os.Exit(exitError)
+	}
+	settings, err := model.daemonModel(nbt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving the model path: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	os.Remove(*socket)
+	ln, err := net.Listen("unix", *socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listening: %v\n", err)
+		os.Exit(exitError)
+	}
+	fmt.Fprintf(os.Stderr, "Listening on %s\n", *socket)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "Error accepting: %v\n", err)
+			}
+			break
+		}
+		go serveDaemonConn(conn, nbt, settings, *jobs)
+	}
+}
+
+// serveDaemonConn serves one client of a daemon whose model has settings
+func serveDaemonConn(conn net.Conn, nbt *goahmedfrasa.Farasa, settings daemonModel, jobs int) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	header, err := reader.ReadBytes('\n')
+	if err != nil {
+		return
+	}
+	var req daemonRequest
+	if err = json.Unmarshal(header, &req); err != nil {
+		fmt.Fprintf(os.Stderr, "Bad client request: %v\n", err)
+		err = fmt.Errorf("bad request: %w", err)
+	} else {
+		err = settings.check(req.Model)
+	}
+	var resp daemonResponse
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	answer, _ := json.Marshal(resp)
+	if _, werr := conn.Write(append(answer, '\n')); werr != nil || err != nil {
+		return
+	}
+	writer := bufio.NewWriter(conn)
+	if _, err := processLines(reader, writer, jobs, req.format(nbt)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading from client: %v\n", err)
+	}
+	writer.Flush()
+}
+
+// errNoDaemon is returned by segmentWithDaemon when nothing listens on the
+// socket
+var errNoDaemon = errors.New("no daemon running")
+
+// segmentWithDaemon sends the text of reader to the daemon listening on socket
+// and copies the answer to writer. It fails without reading from reader when
+// the daemon refuses the request.
+func segmentWithDaemon(socket string, req daemonRequest, reader io.Reader, writer io.Writer) error {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errNoDaemon, err)
+	}
+	defer conn.Close()
+
+	header, _ := json.Marshal(req)
+	if _, err := conn.Write(append(header, '\n')); err != nil {
+		return err
+	}
+	answers := bufio.NewReader(conn)
+	line, err := answers.ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("reading the daemon's answer: %w", err)
+	}
+	var resp daemonResponse
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return fmt.Errorf("reading the daemon's answer: %w", err)
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(writer, answers)
+		done <- err
+	}()
+	if _, err := io.Copy(conn, reader); err != nil {
+		return err
+	}
+	if err := conn.(*net.UnixConn).CloseWrite(); err != nil {
+		return err
+	}
+	return <-done
+}
+
+// defaultSocket is the socket path used when -socket is not given to the
+// daemon
+func defaultSocket() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("goahmedfrasa-%d.sock", os.Getuid()))
+}
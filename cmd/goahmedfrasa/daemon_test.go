@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"goahmedfrasa/pkg/goahmedfrasa"
+)
+
+// startDaemon serves nbt, loaded from the dictionary fixture, on a socket in a
+// temporary directory and returns its path
+func startDaemon(t *testing.T, nbt *goahmedfrasa.Farasa) string {
+	t.Helper()
+	// a short directory, as socket paths are limited to about 100 bytes
+	dir, err := os.MkdirTemp("", "goahmedfrasa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "daemon.sock")
+
+	model := modelFlags{dataDir: testDataDir, temperature: 1}
+	settings, err := model.daemonModel(nbt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveDaemonConn(conn, nbt, settings, 2)
+		}
+	}()
+	return socket
+}
+
+// loadTestModel loads the dictionary fixture
+func loadTestModel(t *testing.T) *goahmedfrasa.Farasa {
+	t.Helper()
+	nbt, err := goahmedfrasa.NewFarasa(testDataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nbt
+}
+
+func TestDaemonModelCheck(t *testing.T) {
+	data, other := "/data", "/other"
+	one, two := 1.0, 2.0
+	yes, no := true, false
+	daemon := daemonModel{Data: &data, Weights: goahmedfrasa.DefaultWeights(), Temperature: &one, ValidAffixes: &no}
+	embedded, none := daemon, ""
+	embedded.Data = &none
+
+	tests := []struct {
+		name   string
+		daemon daemonModel
+		client daemonModel
+		want   string
+	}{
+		{"no settings", daemon, daemonModel{}, ""},
+		{"same settings", daemon, daemonModel{Data: &data, Weights: goahmedfrasa.DefaultWeights(), Temperature: &one, ValidAffixes: &no}, ""},
+		{"other data", daemon, daemonModel{Data: &other}, "the daemon loaded /data, not /other"},
+		{"data for the embedded dictionaries", embedded, daemonModel{Data: &data}, "the daemon loaded the embedded dictionaries, not /data"},
+		{"other weights", daemon, daemonModel{Weights: make([]float64, goahmedfrasa.NumFeatures)}, "the daemon uses other scoring weights than -w"},
+		{"other temperature", daemon, daemonModel{Temperature: &two}, "the daemon uses temperature 1, not 2"},
+		{"valid affixes", daemon, daemonModel{ValidAffixes: &yes}, "the daemon runs with -valid-affixes=false"},
+	}
+	for _, tt := range tests {
+		err := tt.daemon.check(tt.client)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("%s: %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestSegmentWithDaemon checks that a client gets what segmenting in process
+// prints, the daemon answering once the client has closed its side for writing
+func TestSegmentWithDaemon(t *testing.T) {
+	nbt := loadTestModel(t)
+	socket := startDaemon(t, nbt)
+	for _, req := range []daemonRequest{
+		{Normalize: true},
+		{Scheme: "atb"},
+		{Normalize: true, NBest: 2},
+	} {
+		// the last line is unterminated, so the daemon only has it once the
+		// client closes its side
+		input := "والكتاب مشروب\nكتابه\r\nللتواصل"
+		var want bytes.Buffer
+		w := bufio.NewWriter(&want)
+		if _, err := processLines(bufio.NewReader(strings.NewReader(input)), w, 1, req.format(nbt)); err != nil {
+			t.Fatal(err)
+		}
+		w.Flush()
+
+		var got bytes.Buffer
+		if err := segmentWithDaemon(socket, req, strings.NewReader(input), &got); err != nil {
+			t.Fatalf("%+v: %v", req, err)
+		}
+		if got.String() != want.String() {
+			t.Errorf("%+v: daemon wrote %q, want %q", req, got.String(), want.String())
+		}
+	}
+}
+
+// unreadable fails the test when read
+type unreadable struct{ t *testing.T }
+
+func (r unreadable) Read([]byte) (int, error) {
+	r.t.Error("input read after the daemon refused the request")
+	return 0, errors.New("unreadable")
+}
+
+func TestDaemonRefusesOtherModel(t *testing.T) {
+	socket := startDaemon(t, loadTestModel(t))
+	two := 2.0
+	req := daemonRequest{Normalize: true, Model: daemonModel{Temperature: &two}}
+	var out bytes.Buffer
+	err := segmentWithDaemon(socket, req, unreadable{t}, &out)
+	if err == nil || errors.Is(err, errNoDaemon) || !strings.Contains(err.Error(), "temperature") {
+		t.Errorf("got error %v, want the temperature mismatch", err)
+	}
+	if out.Len() > 0 {
+		t.Errorf("refused request wrote %q", out.String())
+	}
+}
+
+// TestNoDaemon checks that segment loads the model itself when nothing listens
+// on the socket, with the same output
+func TestNoDaemon(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "missing.sock")
+	if err := segmentWithDaemon(socket, daemonRequest{}, unreadable{t}, &bytes.Buffer{}); !errors.Is(err, errNoDaemon) {
+		t.Errorf("got error %v, want %v", err, errNoDaemon)
+	}
+
+	input := "والكتاب مشروب\n"
+	want, _, _ := runCommand(t, input, "-d", testDataDir)
+	got, stderr, code := runCommand(t, input, "-d", testDataDir, "-socket", socket)
+	if code != 0 {
+		t.Fatalf("exit status %d\n%s", code, stderr)
+	}
+	if !strings.Contains(stderr, "No daemon listening on "+socket) {
+		t.Errorf("stderr does not tell the daemon is missing:\n%s", stderr)
+	}
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
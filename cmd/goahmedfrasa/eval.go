@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+)
+
+// runEval implements "goahmedfrasa eval -i gold.txt [flags]", which prints the
+// accuracy of the segmenter on a gold corpus and, with -errors, the words it
+// gets wrong
+func runEval(args []string) {
+	fs := newFlagSet("eval")
+	var model modelFlags
+	model.register(fs)
+	goldFile := fs.String("i", "", "Gold segmented corpus")
+	scheme := fs.String("c", "", "Segmentation scheme of the gold corpus (atb)")
+	showErrors := fs.Bool("errors", false, "Print every wrongly segmented word as gold<TAB>segmented")
+	fs.Parse(args)
+
+	if *goldFile == "" {
+		fmt.Fprintln(os.Stderr, "eval needs a gold corpus given with -i")
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	if *scheme != "" && *scheme != "atb" {
+		fmt.Fprintf(os.Stderr, "Unknown scheme %q\n", *scheme)
+		os.Exit(exitUsage)
+	}
+
+	nbt, err := model.load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing Farasa: %v\n", err)
+		os.Exit(exitError)
+	}
+	in, err := os.Open(*goldFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening gold corpus: %v\n", err)
+		os.Exit(exitError)
+	}
+	defer in.Close()
+
+	res, err := nbt.Evaluate(context.Background(), in, *scheme)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading gold corpus: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	writer := bufio.NewWriter(os.Stdout)
+	defer writer.Flush()
+	if *showErrors {
+		for _, e := range res.Errors {
+			fmt.Fprintf(writer, "%s\t%s\n", e.Gold, e.Segmented)
+		}
+	}
+	fmt.Fprintf(writer, "%d words, %d correct: %.2f%% accuracy\n", res.Words, res.Correct, 100*res.Accuracy)
+}
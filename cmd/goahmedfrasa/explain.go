@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"goahmedfrasa/pkg/goahmedfrasa"
+)
+
+// runExplain implements "goahmedfrasa explain [flags] [words...]", which prints
+// the score breakdown of the candidates of every word given as an argument or,
+// without arguments, of every word read from stdin
+func runExplain(args []string) {
+	fs := newFlagSet("explain")
+	var model modelFlags
+	model.register(fs)
+	jsonOut := fs.Bool("json", false, "Print JSON, one object per word")
+	top := fs.Int("top", 5, "Number of candidates to show per word, 0 for all")
+	candidates := fs.Bool("candidates", false, "Only list the candidate partitions generated within the search limits for every word, sorted")
+	fs.Parse(args)
+
+	nbt, err := model.load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing Farasa: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	var words []string
+	for _, arg := range fs.Args() {
+		words = append(words, goahmedfrasa.Tokenize(goahmedfrasa.RemoveDiacritics(arg))...)
+	}
+	if fs.NArg() == 0 {
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+		for scanner.Scan() {
+			words = append(words, goahmedfrasa.Tokenize(goahmedfrasa.RemoveDiacritics(scanner.Text()))...)
+		}
+	}
+
+	writer := bufio.NewWriter(os.Stdout)
+	defer writer.Flush()
+	enc := json.NewEncoder(writer)
+	enc.SetEscapeHTML(false)
+	for _, w := range words {
+		if *candidates {
+			parts, ok := nbt.PartitionsWithinLimits(goahmedfrasa.Buck2UTF8(w))
+			if !ok {
+				fmt.Fprintf(writer, "%s\tbeyond the search limits\n", w)
+				continue
+			}
+			sort.Strings(parts)
+			fmt.Fprintf(writer, "%s\t%s\n", w, strings.Join(parts, " "))
+			continue
+		}
+		e := nbt.Explain(w)
+		if *top > 0 && len(e.Candidates) > *top {
+			e.Candidates = e.Candidates[:*top]
+		}
+		if *jsonOut {
+			if err := enc.Encode(e); err != nil {
+				fmt.Fprintf(os.Stderr, "Error encoding %s: %v\n", w, err)
+			}
+			continue
+		}
+		printExplanation(writer, e, false)
+	}
+}
+
+// printExplanation writes e as one table per candidate. buck adds the
+// Buckwalter transliteration of the word, segmentation and partitions.
+func printExplanation(w io.Writer, e goahmedfrasa.Explanation, buck bool) {
+	source := "scorer"
+	if e.SeenBefore {
+		source = "SeenBefore"
+	}
+	translit := func(s string) string {
+		if buck {
+			return s + " " + goahmedfrasa.UTF82Buck(s)
+		}
+		return s
+	}
+	fmt.Fprintf(w, "%s\t%s (%s)\n", translit(e.Word), translit(e.Segmentation), source)
+	for i, c := range e.Candidates {
+		fmt.Fprintf(w, "  #%d %s score=%.6f template=%s\n", i+1, translit(c.Partition), c.Score, c.Template)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "    feature\t     value\t    weight\tcontribution")
+		for _, fc := range c.Features {
+			fmt.Fprintf(tw, "    %d %s\t%10.6f\t%10.6f\t%12.6f\n", fc.Index, fc.Name, fc.Value, fc.Weight, fc.Contribution)
+		}
+		tw.Flush()
+	}
+	fmt.Fprintln(w)
+}
@@ -2,165 +2,202 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"strings"
+	"time"
 
+	"goahmedfrasa/data"
 	"goahmedfrasa/pkg/goahmedfrasa"
 )
 
 func main() {
-	inputFile := flag.String("i", "", "Input file path")
-	outputFile := flag.String("o", "", "Output file path")
-	scheme := flag.String("c", "", "Segmentation scheme (atb)")
-	normFlag := flag.Bool("n", true, "Normalization (true/false)")
-	dataDir := flag.String("d", "", "Data directory path")
-	flag.Parse()
-
-	// Determine data directory
-	dir := *dataDir
-	if dir == "" {
-		dir = os.Getenv("FarasaDataDir")
-	}
-	if dir == "" {
-		// Try default relative path
-		dir = "data/"
-	}
-	if !strings.HasSuffix(dir, "/") {
-		dir += "/"
+	dispatch(os.Args[1:])
+}
+
+// runSegment implements "goahmedfrasa segment [flags]", which is also what runs
+// when goahmedfrasa is given only flags
+func runSegment(args []string) {
+	fs := newFlagSet("segment")
+	var files ioFlags
+	files.register(fs)
+	scheme := fs.String("c", "", "Segmentation scheme (atb)")
+	normFlag := fs.Bool("n", true, "Normalization (true/false)")
+	nbest := fs.Int("nbest", 0, "Print the N best segmentations of every word with probabilities as JSON")
+	jobs := fs.Int("j", 1, "Number of lines segmented in parallel")
+	socket := fs.String("socket", "", "Unix socket of a daemon to segment with, loading the model here if none is running")
+	stats := fs.Bool("stats", false, "Print the number of words segmented and the throughput to stderr")
+	var model modelFlags
+	model.register(fs)
+	fs.Parse(args)
+
+	reader, writer, closeFiles := files.open()
+	defer closeFiles()
+
+	req := daemonRequest{Scheme: *scheme, Normalize: *normFlag, NBest: *nbest}
+	if *socket != "" {
+		var err error
+		if req.Model, err = model.clientModel(fs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading the model flags: %v\n", err)
+			os.Exit(exitError)
+		}
+		err = segmentWithDaemon(*socket, req, reader, writer)
+		if err == nil {
+			return
+		}
+		if !errors.Is(err, errNoDaemon) {
+			closeFiles()
+			fmt.Fprintf(os.Stderr, "Error segmenting with the daemon: %v\n", err)
+			os.Exit(exitError)
+		}
+		fmt.Fprintf(os.Stderr, "No daemon listening on %s, loading the model\n", *socket)
 	}
 
 	fmt.Fprint(os.Stderr, "Initializing the system ....")
 
-	nbt, err := goahmedfrasa.NewFarasa(dir)
+	nbt, err := model.load()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "\nError initializing Farasa: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitError)
 	}
 
 	fmt.Fprint(os.Stderr, "\r")
 	fmt.Fprintln(os.Stderr, "System ready!               ")
 
-	// Set up reader
-	var reader *bufio.Reader
-	if *inputFile != "" {
-		f, err := os.Open(*inputFile)
+	start := time.Now()
+	words, err := processLines(reader, writer, *jobs, req.format(nbt))
+	if err != nil {
+		// keep the output of the lines read before the error
+		closeFiles()
+		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+		os.Exit(exitError)
+	}
+	if *stats {
+		elapsed := time.Since(start)
+		fmt.Fprintf(os.Stderr, "Segmented %d words in %v (%.0f words/sec)\n", words, elapsed.Round(time.Millisecond), float64(words)/elapsed.Seconds())
+	}
+}
+
+// ioFlags are the -i and -o flags of the subcommands reading text line by line
+type ioFlags struct {
+	input  string
+	output string
+}
+
+func (f *ioFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.input, "i", "", "Input file path (default: stdin)")
+	fs.StringVar(&f.output, "o", "", "Output file path (default: stdout)")
+}
+
+// open opens the input and output, exiting when either fails. The returned
+// function flushes the output and closes the files.
+func (f *ioFlags) open() (*bufio.Reader, *bufio.Writer, func()) {
+	in, out := os.Stdin, os.Stdout
+	if f.input != "" {
+		file, err := os.Open(f.input)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error opening input file: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitError)
 		}
-		defer f.Close()
-		reader = bufio.NewReader(f)
-	} else {
-		reader = bufio.NewReader(os.Stdin)
+		in = file
 	}
-
-	// Set up writer
-	var writer *bufio.Writer
-	if *outputFile != "" {
-		f, err := os.Create(*outputFile)
+	if f.output != "" {
+		file, err := os.Create(f.output)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitError)
 		}
-		defer f.Close()
-		writer = bufio.NewWriter(f)
-	} else {
-		writer = bufio.NewWriter(os.Stdout)
+		out = file
 	}
-	defer writer.Flush()
-
-	processBuffer(reader, writer, nbt, *scheme, *normFlag)
-}
-
-func processBuffer(reader *bufio.Reader, writer *bufio.Writer, nbt *goahmedfrasa.Farasa, scheme string, norm bool) {
-	scanner := bufio.NewScanner(reader)
-	// Increase scanner buffer for long lines
-	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		words := goahmedfrasa.Tokenize(goahmedfrasa.RemoveDiacritics(line))
-
-		for _, w := range words {
-			if cached, ok := nbt.HmSeenBefore[w]; !ok {
-				solutions := nbt.MostLikelyPartition(goahmedfrasa.Buck2UTF8(w), 1)
-				topSolution := w
-				if len(solutions) > 0 {
-					topSolution = solutions[0].GetPartition()
-				}
-				topSolution = strings.ReplaceAll(strings.ReplaceAll(topSolution, ";", ""), "++", "+")
-				nbt.HmSeenBefore[w] = topSolution
-
-				if scheme == "atb" {
-					topSolution = produceSpecialSegmentation(topSolution, nbt, norm)
-				} else {
-					if norm {
-						topSolution = goahmedfrasa.NormalizeFull(topSolution)
-					}
-				}
-				nbt.HmSeenBefore[w] = topSolution
-				writer.WriteString(topSolution + " ")
-				writer.Flush()
-			} else {
-				var topSolution string
-				if scheme == "atb" {
-					cleaned := strings.ReplaceAll(strings.ReplaceAll(cached, ";", ""), "++", "+")
-					topSolution = produceSpecialSegmentation(cleaned, nbt, norm)
-				} else {
-					topSolution = strings.ReplaceAll(strings.ReplaceAll(cached, ";", ""), "++", "+")
-					if norm {
-						topSolution = goahmedfrasa.NormalizeFull(topSolution)
-					}
-				}
-				writer.WriteString(topSolution + " ")
+	writer := bufio.NewWriter(out)
+	return bufio.NewReader(in), writer, func() {
+		if err := writer.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+			os.Exit(exitError)
+		}
+		if in != os.Stdin {
+			in.Close()
+		}
+		if out != os.Stdout {
+			if err := out.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+				os.Exit(exitError)
 			}
 		}
-		writer.WriteString("\n")
 	}
 }
 
-func produceSpecialSegmentation(segmentedWord string, nbt *goahmedfrasa.Farasa, norm bool) string {
-	tmp := nbt.GetProperSegmentation(segmentedWord)
-
-	// attach Al to the word
-	tmp = strings.ReplaceAll(tmp, "\u0627\u0644+;", ";\u0627\u0644")
+// modelFlags are the flags selecting and tuning the model, shared by the
+// subcommands
+type modelFlags struct {
+	dataDir      string
+	mmap         bool
+	weightsFile  string
+	temperature  float64
+	validAffixes bool
+}
 
-	// attach ta marbouta
-	tmp = strings.ReplaceAll(tmp, ";+\u0629", "\u0629;")
+func (m *modelFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&m.dataDir, "d", "", "Data directory or binary model file path")
+	fs.BoolVar(&m.mmap, "m", false, "Memory-map the binary model file given with -d")
+	fs.StringVar(&m.weightsFile, "w", "", "Scoring weights file in index:weight format")
+	fs.Float64Var(&m.temperature, "t", 1, "Temperature for n-best probabilities")
+	fs.BoolVar(&m.validAffixes, "valid-affixes", false, "Only consider prefix and suffix combinations seen in the training data")
+}
 
-	// normalize output
-	if norm {
-		tmp = goahmedfrasa.NormalizeFull(tmp)
+// source returns the data directory or model file load reads, or whether it
+// uses the embedded dictionaries
+func (m *modelFlags) source() (dir string, embedded bool) {
+	dir = m.dataDir
+	if dir == "" {
+		dir = os.Getenv("FarasaDataDir")
 	}
-
-	// concat all prefixes and all suffixes
-	parts := strings.Split(" "+tmp+" ", ";")
-
-	output := ""
-
-	// handle prefix
-	prefixPart := strings.ReplaceAll(strings.TrimSpace(parts[0]), "+", "")
-	if len(prefixPart) > 0 {
-		output += prefixPart + "+ "
+	if dir == "" && data.FS != nil {
+		return "", true
+	}
+	if dir == "" {
+		// Try default relative path
+		dir = "data/"
 	}
+	return dir, false
+}
 
-	// handle stem
-	output += strings.TrimSpace(parts[1])
+// load loads the segmenter from the data directory, falling back to
+// $FarasaDataDir, the embedded dictionaries and finally data/. extra options
+// are applied after those of the flags.
+func (m *modelFlags) load(extra ...goahmedfrasa.Option) (*goahmedfrasa.Farasa, error) {
+	dir, useEmbedded := m.source()
 
-	// handle suffix
-	suffixPart := strings.ReplaceAll(strings.TrimSpace(parts[2]), "+", "")
-	if len(suffixPart) > 0 {
-		output += " +" + suffixPart
+	opts := []goahmedfrasa.Option{goahmedfrasa.WithTemperature(m.temperature)}
+	if m.weightsFile != "" {
+		opts = append(opts, goahmedfrasa.WithWeightsFile(m.weightsFile))
 	}
-
-	output = strings.TrimSpace(output)
-	for strings.HasPrefix(output, "+") {
-		output = output[1:]
+	if m.validAffixes {
+		opts = append(opts, goahmedfrasa.WithValidAffixes())
+	}
+	opts = append(opts, extra...)
+
+	switch {
+	case useEmbedded:
+		return goahmedfrasa.NewFarasaFS(data.FS, opts...)
+	case m.mmap:
+		return goahmedfrasa.NewFarasaMmap(dir, opts...)
+	default:
+		return goahmedfrasa.NewFarasa(dir, opts...)
 	}
-	for strings.HasSuffix(output, "+") {
-		output = output[:len(output)-1]
+}
+
+// segmentLine returns the format function for plain segmentation, which puts
+// a space after every segmented word
+func segmentLine(nbt *goahmedfrasa.Farasa, opts goahmedfrasa.SegmentOptions) func(string, *bytes.Buffer) int {
+	return func(line string, out *bytes.Buffer) int {
+		tokens, _ := nbt.SegmentWith(line, opts)
+		for _, tok := range tokens {
+			out.WriteString(tok.Segmented + " ")
+		}
+		out.WriteString("\n")
+		return len(tokens)
 	}
-	return output
 }
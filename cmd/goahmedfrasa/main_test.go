@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// testDataDir is the dictionary fixture of the repository
+const testDataDir = "../../testdata/data/"
+
+// TestMain runs the command instead of the tests when the test binary is
+// started by runCommand
+func TestMain(m *testing.M) {
+	if os.Getenv("GOAHMEDFRASA_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runCommand runs goahmedfrasa with args and stdin, returning its output and
+// exit status
+func runCommand(t *testing.T, stdin string, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "GOAHMEDFRASA_TEST_MAIN=1", "FarasaDataDir=")
+	cmd.Stdin = strings.NewReader(stdin)
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err := cmd.Run()
+	var exit *exec.ExitError
+	switch {
+	case errors.As(err, &exit):
+		code = exit.ExitCode()
+	case err != nil:
+		t.Fatal(err)
+	}
+	return out.String(), errOut.String(), code
+}
+
+// TestWordCommands checks the output of stem, root and template. Templates and
+// roots are matched on the stems as spelled, so -n only changes the stems.
+func TestWordCommands(t *testing.T) {
+	input := "أسئلة وبالكتاب والمدرسة للمؤتمرات\n"
+	tests := []struct {
+		command, norm, want string
+	}{
+		{"stem", "-n=true", "اسءل كتاب مدرس مءتمر \n"},
+		{"stem", "-n=false", "أسئل كتاب مدرس مؤتمر \n"},
+		{"root", "-n=true", "سال كتب درس امر \n"},
+		{"root", "-n=false", "سال كتب درس امر \n"},
+		{"template", "-n=true", ">fEl fEAl mfEl mftEl \n"},
+		{"template", "-n=false", ">fEl fEAl mfEl mftEl \n"},
+	}
+	for _, tt := range tests {
+		out, stderr, code := runCommand(t, input, tt.command, "-d", testDataDir, tt.norm)
+		if code != 0 {
+			t.Fatalf("%s %s: exit status %d\n%s", tt.command, tt.norm, code, stderr)
+		}
+		if out != tt.want {
+			t.Errorf("%s %s: got %q, want %q", tt.command, tt.norm, out, tt.want)
+		}
+	}
+}
+
+// TestParallelOrder checks that -j 8 writes the lines in input order, over
+// enough lines for every worker to get several batches
+func TestParallelOrder(t *testing.T) {
+	data, err := os.ReadFile("../../testdata/partitions.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	corpus := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var input strings.Builder
+	for i := 0; i < 20*batchLines; i++ {
+		// every line differs from its neighbours
+		input.WriteString(corpus[i%len(corpus)] + " " + corpus[(i/len(corpus))%len(corpus)] + "\n")
+	}
+	want, stderr, code := runCommand(t, input.String(), "-d", testDataDir, "-j", "1")
+	if code != 0 {
+		t.Fatalf("-j 1: exit status %d\n%s", code, stderr)
+	}
+	got, stderr, code := runCommand(t, input.String(), "-d", testDataDir, "-j", "8", "-stats")
+	if code != 0 {
+		t.Fatalf("-j 8: exit status %d\n%s", code, stderr)
+	}
+	if got != want {
+		gotLines, wantLines := strings.Split(got, "\n"), strings.Split(want, "\n")
+		for i := range wantLines {
+			if i >= len(gotLines) || gotLines[i] != wantLines[i] {
+				t.Fatalf("-j 8 differs from -j 1 at line %d", i+1)
+			}
+		}
+		t.Fatalf("-j 8 wrote %d lines, -j 1 %d", len(gotLines), len(wantLines))
+	}
+	if !strings.Contains(stderr, "Segmented ") {
+		t.Errorf("-stats printed no statistics:\n%s", stderr)
+	}
+	if _, stderr, _ := runCommand(t, "كتاب\n", "-d", testDataDir); strings.Contains(stderr, "Segmented ") {
+		t.Errorf("statistics printed without -stats:\n%s", stderr)
+	}
+}
+
+func TestEval(t *testing.T) {
+	out, stderr, code := runCommand(t, "", "eval", "-d", testDataDir, "-i", "../../testdata/gold.txt")
+	if code != 0 {
+		t.Fatalf("exit status %d\n%s", code, stderr)
+	}
+	if want := "200 words, 197 correct: 98.50% accuracy\n"; out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+
+	out, _, _ = runCommand(t, "", "eval", "-d", testDataDir, "-i", "../../testdata/gold.txt", "-errors")
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("-errors printed %d lines, want 3 errors and the accuracy:\n%s", len(lines), out)
+	}
+	for _, line := range lines[:3] {
+		if gold, seg, ok := strings.Cut(line, "\t"); !ok || gold == seg {
+			t.Errorf("error line %q is not gold<TAB>segmented", line)
+		}
+	}
+}
+
+// TestExitCodes checks that failures at run time exit with 1 and bad flags or
+// arguments with 2
+func TestExitCodes(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"help", []string{"help"}, 0},
+		{"segment", []string{"-d", testDataDir}, 0},
+		{"unknown command", []string{"frobnicate"}, exitUsage},
+		{"unknown help topic", []string{"help", "frobnicate"}, exitUsage},
+		{"unknown flag", []string{"stem", "-frobnicate"}, exitUsage},
+		{"eval without gold", []string{"eval", "-d", testDataDir}, exitUsage},
+		{"eval with unknown scheme", []string{"eval", "-d", testDataDir, "-i", "../../testdata/gold.txt", "-c", "xyz"}, exitUsage},
+		{"train without epochs", []string{"train", "-d", testDataDir, "-i", "../../testdata/gold.txt", "-epochs", "0"}, exitUsage},
+		{"missing data", []string{"stem", "-d", "testdata/missing/"}, exitError},
+		{"missing input", []string{"stem", "-d", testDataDir, "-i", "testdata/missing.txt"}, exitError},
+		{"missing gold", []string{"eval", "-d", testDataDir, "-i", "testdata/missing.txt"}, exitError},
+	}
+	for _, tt := range tests {
+		if _, stderr, code := runCommand(t, "", tt.args...); code != tt.code {
+			t.Errorf("%s: exit status %d, want %d\n%s", tt.name, code, tt.code, stderr)
+		}
+	}
+}
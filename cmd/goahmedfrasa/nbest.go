@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"goahmedfrasa/pkg/goahmedfrasa"
+)
+
+type nbestEntry struct {
+	Segmentation string  `json:"segmentation"`
+	Partition    string  `json:"partition"`
+	Score        float64 `json:"score"`
+	Probability  float64 `json:"probability"`
+	Margin       float64 `json:"margin"`
+}
+
+type nbestWord struct {
+	Word string `json:"word"`
+	// Segmentation is what plain segmentation prints for the word
+	Segmentation string       `json:"segmentation"`
+	NBest        []nbestEntry `json:"nbest"`
+}
+
+// nbestLine returns the format function for -nbest, which writes one JSON
+// array per line holding the n best segmentations of every word
+func nbestLine(nbt *goahmedfrasa.Farasa, n int, opts goahmedfrasa.SegmentOptions) func(string, *bytes.Buffer) int {
+	return func(line string, out *bytes.Buffer) int {
+		tokens, _ := nbt.SegmentWith(line, opts)
+		words := make([]nbestWord, 0, len(tokens))
+		for _, tok := range tokens {
+			w := nbestWord{Word: tok.Text, Segmentation: tok.Segmented, NBest: []nbestEntry{}}
+			for _, c := range nbt.NBest(tok.Text, n, opts) {
+				w.NBest = append(w.NBest, nbestEntry{
+					Segmentation: c.Segmented,
+					Partition:    c.Partition,
+					Score:        c.Score,
+					Probability:  c.Probability,
+					Margin:       c.Margin,
+				})
+			}
+			words = append(words, w)
+		}
+		enc := json.NewEncoder(out)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(words); err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding n-best list: %v\n", err)
+		}
+		return len(tokens)
+	}
+}
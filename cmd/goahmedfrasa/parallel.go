@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+// batchLines is the number of input lines handed to a worker at a time
+const batchLines = 256
+
+// lineBatch is a run of input lines and their formatted output. done is closed
+// once out is complete.
+type lineBatch struct {
+	lines []string
+	out   bytes.Buffer
+	words int
+	done  chan struct{}
+}
+
+// processLines reads reader line by line, formats the lines with format on jobs
+// goroutines sharing the segmenter and writes the output to writer in input
+// order. format writes the output for one line to out and returns the number
+// of words in it. processLines returns the total number of words and the first
+// read error.
+func processLines(reader *bufio.Reader, writer *bufio.Writer, jobs int, format func(line string, out *bytes.Buffer) int) (int, error) {
+	jobs = max(jobs, 1)
+	work := make(chan *lineBatch, jobs)
+	// pending holds the batches in input order; its capacity bounds the
+	// number of batches in memory
+	pending := make(chan *lineBatch, 2*jobs)
+
+	for i := 0; i < jobs; i++ {
+		go func() {
+			for b := range work {
+				for _, line := range b.lines {
+					b.words += format(line, &b.out)
+				}
+				close(b.done)
+			}
+		}()
+	}
+
+	var readErr error
+	go func() {
+		defer close(work)
+		defer close(pending)
+		b := &lineBatch{done: make(chan struct{})}
+		for {
+			line, err := reader.ReadString('\n')
+			if len(line) > 0 {
+				line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+				b.lines = append(b.lines, line)
+			}
+			if len(b.lines) == batchLines || err != nil && len(b.lines) > 0 {
+				pending <- b
+				work <- b
+				b = &lineBatch{done: make(chan struct{})}
+			}
+			if err != nil {
+				if err != io.EOF {
+					readErr = err
+				}
+				return
+			}
+		}
+	}()
+
+	words := 0
+	for b := range pending {
+		<-b.done
+		writer.Write(b.out.Bytes())
+		words += b.words
+	}
+	return words, readErr
+}
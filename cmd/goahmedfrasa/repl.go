@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+
+	"goahmedfrasa/pkg/goahmedfrasa"
+)
+
+// maxHistory is the number of entries the REPL keeps and saves
+const maxHistory = 1000
+
+const replHelp = `Type Arabic or Buckwalter words to segment them, or a command:
+  :nbest [N]         show the N (5) best segmentations of every word, 0 for off
+  :explain [on|off]  show the score breakdown of the candidates
+  :template [on|off] show the template and root of the stem
+  :scheme atb|farasa segmentation scheme
+  :norm on|off       normalization of the output
+  :settings          show the settings above
+  :history           list earlier inputs; !N repeats input N, !! the last one
+  :help              this text
+  :quit              leave, as does end of input
+`
+
+// repl is the state of an interactive session
+type repl struct {
+	nbt      *goahmedfrasa.Farasa
+	out      *bufio.Writer
+	opts     goahmedfrasa.SegmentOptions
+	nbest    int
+	explain  bool
+	template bool
+
+	history []string
+	// historyFile receives every new history entry, nil when history is not
+	// saved
+	historyFile *os.File
+}
+
+// runREPL implements "goahmedfrasa repl [flags]", which loads the model once
+// and segments the words typed on stdin until :quit or the end of input
+func runREPL(args []string) {
+	fs := newFlagSet("repl")
+	var model modelFlags
+	model.register(fs)
+	historyPath := fs.String("history", defaultHistoryPath(), "File keeping the input history across sessions, empty for none")
+	fs.Parse(args)
+
+	interactive := isTerminal(os.Stdin)
+	if interactive {
+		fmt.Fprint(os.Stderr, "Initializing the system ....")
+	}
+	nbt, err := model.load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nError initializing Farasa: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	r := &repl{nbt: nbt, out: bufio.NewWriter(os.Stdout)}
+	defer r.out.Flush()
+	// input piped in is not worth remembering
+	if interactive && *historyPath != "" {
+		if err := r.loadHistory(*historyPath); err != nil {
+			fmt.Fprintf(os.Stderr, "\nError loading history: %v\n", err)
+		}
+		f, err := os.OpenFile(*historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nNot saving history: %v\n", err)
+		} else {
+			defer f.Close()
+			r.historyFile = f
+		}
+	}
+	if interactive {
+		fmt.Fprint(os.Stderr, "\r")
+		fmt.Fprintln(os.Stderr, "System ready! :help lists the commands")
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		if interactive {
+			r.out.WriteString("farasa> ")
+			r.out.Flush()
+		}
+		line, err := reader.ReadString('\n')
+		if !r.handle(strings.TrimSpace(line)) {
+			return
+		}
+		r.out.Flush()
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+				os.Exit(exitError)
+			}
+			if interactive {
+				r.out.WriteString("\n")
+			}
+			return
+		}
+	}
+}
+
+// handle runs one line of input and returns false when the session ends
+func (r *repl) handle(line string) bool {
+	if line == "" {
+		return true
+	}
+	if strings.HasPrefix(line, "!") {
+		recalled, ok := r.recall(line)
+		if !ok {
+			fmt.Fprintf(r.out, "No history entry %s\n", line)
+			return true
+		}
+		line = recalled
+		fmt.Fprintln(r.out, line)
+	}
+	r.addHistory(line)
+
+	if !strings.HasPrefix(line, ":") {
+		r.segment(line)
+		return true
+	}
+	fields := strings.Fields(line)
+	cmd, args := fields[0], fields[1:]
+	switch cmd {
+	case ":nbest":
+		n := 5
+		if len(args) > 0 {
+			v, err := strconv.Atoi(args[0])
+			if err != nil || v < 0 {
+				fmt.Fprintf(r.out, "Expected a number of segmentations, got %q\n", args[0])
+				return true
+			}
+			n = v
+		}
+		r.nbest = n
+	case ":explain":
+		r.explain = r.toggle(r.explain, args)
+	case ":template":
+		r.template = r.toggle(r.template, args)
+	case ":scheme":
+		switch {
+		case len(args) == 1 && args[0] == "atb":
+			r.opts.Scheme = "atb"
+		case len(args) == 1 && args[0] == "farasa":
+			r.opts.Scheme = ""
+		default:
+			fmt.Fprintln(r.out, "Expected :scheme atb or :scheme farasa")
+			return true
+		}
+	case ":norm":
+		r.opts.NoNormalize = !r.toggle(!r.opts.NoNormalize, args)
+	case ":settings":
+	case ":history":
+		for i, h := range r.history {
+			fmt.Fprintf(r.out, "%5d  %s\n", i+1, h)
+		}
+		return true
+	case ":help":
+		r.out.WriteString(replHelp)
+		return true
+	case ":quit", ":q", ":exit":
+		return false
+	default:
+		fmt.Fprintf(r.out, "Unknown command %s, :help lists the commands\n", cmd)
+		return true
+	}
+	r.printSettings()
+	return true
+}
+
+// toggle returns the new value of a setting given the arguments of its
+// command: on or off, or nothing to flip it
+func (r *repl) toggle(v bool, args []string) bool {
+	if len(args) == 0 {
+		return !v
+	}
+	switch args[0] {
+	case "on":
+		return true
+	case "off":
+		return false
+	}
+	fmt.Fprintf(r.out, "Expected on or off, got %q\n", args[0])
+	return v
+}
+
+func (r *repl) printSettings() {
+	scheme := "farasa"
+	if r.opts.Scheme != "" {
+		scheme = r.opts.Scheme
+	}
+	onOff := map[bool]string{true: "on", false: "off"}
+	fmt.Fprintf(r.out, "scheme %s, norm %s, nbest %d, explain %s, template %s\n",
+		scheme, onOff[!r.opts.NoNormalize], r.nbest, onOff[r.explain], onOff[r.template])
+}
+
+// segment prints the analysis of every word of line, in Arabic and Buckwalter.
+// A line without Arabic letters is read as Buckwalter.
+func (r *repl) segment(line string) {
+	if strings.IndexFunc(line, func(c rune) bool { return unicode.Is(unicode.Arabic, c) }) < 0 {
+		line = goahmedfrasa.Buck2UTF8(line)
+	}
+	tokens, _ := r.nbt.SegmentWith(line, r.opts)
+	for _, tok := range tokens {
+		fmt.Fprintf(r.out, "%s\t%s\t%s\n", tok.Text, tok.Segmented, goahmedfrasa.UTF82Buck(tok.Segmented))
+		if r.nbest > 0 {
+			tw := tabwriter.NewWriter(r.out, 0, 0, 2, ' ', 0)
+			for i, c := range r.nbt.NBest(tok.Text, r.nbest, r.opts) {
+				fmt.Fprintf(tw, "  %d\t%s\t%s\tp=%.4f\tscore=%.6f\n", i+1, c.Segmented, goahmedfrasa.UTF82Buck(c.Segmented), c.Probability, c.Score)
+			}
+			tw.Flush()
+		}
+		if r.template {
+			// templates are matched on the stem as it is spelled, before
+			// normalization and without the determiner of the atb scheme
+			stem := spelledStem(r.nbt, tok)
+			template, root := r.nbt.FitTemplate(stem)
+			fmt.Fprintf(r.out, "  stem %s %s  template %s", stem, goahmedfrasa.UTF82Buck(stem), template)
+			if root != "" {
+				arabic := goahmedfrasa.RootToUTF8(root)
+				fmt.Fprintf(r.out, "  root %s %s", arabic, goahmedfrasa.UTF82Buck(arabic))
+			}
+			r.out.WriteString("\n")
+		}
+		if r.explain {
+			e := r.nbt.Explain(tok.Text)
+			top := max(r.nbest, 3)
+			if len(e.Candidates) > top {
+				e.Candidates = e.Candidates[:top]
+			}
+			printExplanation(r.out, e, true)
+		}
+	}
+}
+
+// recall returns the history entry of a !N or !! reference
+func (r *repl) recall(ref string) (string, bool) {
+	if ref == "!!" {
+		if len(r.history) == 0 {
+			return "", false
+		}
+		return r.history[len(r.history)-1], true
+	}
+	n, err := strconv.Atoi(ref[1:])
+	if err != nil || n < 1 || n > len(r.history) {
+		return "", false
+	}
+	return r.history[n-1], true
+}
+
+func (r *repl) addHistory(line string) {
+	if len(r.history) > 0 && r.history[len(r.history)-1] == line {
+		return
+	}
+	r.history = append(r.history, line)
+	if len(r.history) > maxHistory {
+		r.history = r.history[len(r.history)-maxHistory:]
+	}
+	if r.historyFile != nil {
+		fmt.Fprintln(r.historyFile, line)
+	}
+}
+
+// loadHistory reads the last maxHistory entries of the history file, cutting
+// the file down to them when it holds more. A missing file is no error.
+func (r *repl) loadHistory(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	truncated := len(lines) > maxHistory
+	if truncated {
+		lines = lines[len(lines)-maxHistory:]
+	}
+	for _, l := range lines {
+		if l != "" {
+			r.history = append(r.history, l)
+		}
+	}
+	if truncated {
+		return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+	}
+	return nil
+}
+
+// defaultHistoryPath is ~/.goahmedfrasa_history, or "" without a home
+// directory
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".goahmedfrasa_history")
+}
+
+// isTerminal tells whether f is a character device such as a terminal
+func isTerminal(f *os.File) bool {
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestHandle runs a session line by line, the settings of each line carrying
+// over to the next
+func TestHandle(t *testing.T) {
+	var out strings.Builder
+	r := &repl{nbt: loadTestModel(t), out: bufio.NewWriter(&out)}
+	tests := []struct {
+		line string
+		want string
+		more bool
+	}{
+		{"", "", true},
+		{"كتابه", "كتابه\tكتاب+ه\tktAb+h\n", true},
+		{"wAlktAb", "والكتاب\tو+ال+كتاب\tw+Al+ktAb\n", true},
+		{":nbest 2", "scheme farasa, norm on, nbest 2, explain off, template off\n", true},
+		{"كتابه", "كتابه\tكتاب+ه\tktAb+h\n  1  كتاب+ه  ktAb+h  p=1.0000  score=-1.453430\n", true},
+		{":nbest many", "Expected a number of segmentations, got \"many\"\n", true},
+		{":nbest -1", "Expected a number of segmentations, got \"-1\"\n", true},
+		{":nbest 0", "scheme farasa, norm on, nbest 0, explain off, template off\n", true},
+		{":template", "scheme farasa, norm on, nbest 0, explain off, template on\n", true},
+		{"مشروب", "مشروب\tمشروب\tm$rwb\n  stem مشروب m$rwb  template mfEwl  root شرب $rb\n", true},
+		{":template off", "scheme farasa, norm on, nbest 0, explain off, template off\n", true},
+		{":explain maybe", "Expected on or off, got \"maybe\"\nscheme farasa, norm on, nbest 0, explain off, template off\n", true},
+		{":scheme atb", "scheme atb, norm on, nbest 0, explain off, template off\n", true},
+		{":scheme xyz", "Expected :scheme atb or :scheme farasa\n", true},
+		{"والكتاب", "والكتاب\tو+ الكتاب\tw+ AlktAb\n", true},
+		{":norm off", "scheme atb, norm off, nbest 0, explain off, template off\n", true},
+		{"!2", "wAlktAb\nوالكتاب\tو+ الكتاب\tw+ AlktAb\n", true},
+		{"!!", "wAlktAb\nوالكتاب\tو+ الكتاب\tw+ AlktAb\n", true},
+		{"!99", "No history entry !99\n", true},
+		{":settings", "scheme atb, norm off, nbest 0, explain off, template off\n", true},
+		{":frobnicate", "Unknown command :frobnicate, :help lists the commands\n", true},
+		{":help", replHelp, true},
+		{":quit", "", false},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		more := r.handle(tt.line)
+		r.out.Flush()
+		if out.String() != tt.want || more != tt.more {
+			t.Errorf("%q: %q, %v, want %q, %v", tt.line, out.String(), more, tt.want, tt.more)
+		}
+	}
+
+	// !99 is no entry; recalled lines are entered once
+	want := []string{"كتابه", "wAlktAb", ":nbest 2", "كتابه", ":nbest many", ":nbest -1", ":nbest 0", ":template", "مشروب", ":template off",
+		":explain maybe", ":scheme atb", ":scheme xyz", "والكتاب", ":norm off", "wAlktAb", ":settings", ":frobnicate", ":help", ":quit"}
+	if !reflect.DeepEqual(r.history, want) {
+		t.Errorf("history %q, want %q", r.history, want)
+	}
+}
+
+func TestRecall(t *testing.T) {
+	tests := []struct {
+		history []string
+		ref     string
+		want    string
+		ok      bool
+	}{
+		{nil, "!!", "", false},
+		{nil, "!1", "", false},
+		{[]string{"a", "b", "c"}, "!!", "c", true},
+		{[]string{"a", "b", "c"}, "!1", "a", true},
+		{[]string{"a", "b", "c"}, "!3", "c", true},
+		{[]string{"a", "b", "c"}, "!4", "", false},
+		{[]string{"a", "b", "c"}, "!0", "", false},
+		{[]string{"a", "b", "c"}, "!-1", "", false},
+		{[]string{"a", "b", "c"}, "!b", "", false},
+		{[]string{"a", "b", "c"}, "!", "", false},
+	}
+	for _, tt := range tests {
+		r := &repl{history: tt.history}
+		if got, ok := r.recall(tt.ref); got != tt.want || ok != tt.ok {
+			t.Errorf("%q in %q: %q, %v, want %q, %v", tt.ref, tt.history, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestLoadHistory(t *testing.T) {
+	dir := t.TempDir()
+	entries := func(from, to int) []string {
+		var lines []string
+		for i := from; i < to; i++ {
+			lines = append(lines, fmt.Sprintf("entry %d", i))
+		}
+		return lines
+	}
+	tests := []struct {
+		name     string
+		contents string
+		want     []string
+		// file is what the history file holds afterwards
+		file string
+	}{
+		{"empty", "", nil, ""},
+		{"blank lines", "a\n\nb\n", []string{"a", "b"}, "a\n\nb\n"},
+		{"no final newline", "a\nb", []string{"a", "b"}, "a\nb"},
+		{"full", strings.Join(entries(0, maxHistory), "\n") + "\n", entries(0, maxHistory), strings.Join(entries(0, maxHistory), "\n") + "\n"},
+		{"too long", strings.Join(entries(0, maxHistory+5), "\n") + "\n", entries(5, maxHistory+5), strings.Join(entries(5, maxHistory+5), "\n") + "\n"},
+	}
+	for i, tt := range tests {
+		path := filepath.Join(dir, fmt.Sprint(i))
+		if err := os.WriteFile(path, []byte(tt.contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		r := &repl{}
+		if err := r.loadHistory(path); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(r.history, tt.want) {
+			t.Errorf("%s: %d entries, want %d", tt.name, len(r.history), len(tt.want))
+		}
+		if data, _ := os.ReadFile(path); string(data) != tt.file {
+			t.Errorf("%s: the file holds %d bytes afterwards, want %d", tt.name, len(data), len(tt.file))
+		}
+	}
+
+	r := &repl{}
+	if err := r.loadHistory(filepath.Join(dir, "missing")); err != nil || r.history != nil {
+		t.Errorf("missing file: %q, %v", r.history, err)
+	}
+	if err := r.loadHistory(dir); err == nil {
+		t.Error("reading a directory: no error")
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"goahmedfrasa/pkg/goahmedfrasa/server"
+)
+
+// runRPC implements "goahmedfrasa rpc [flags]", which loads the model and
+// answers line-delimited JSON-RPC 2.0 requests on stdin with responses on
+// stdout until stdin ends, see server.ServeRPC
+func runRPC(args []string) {
+	fs := newFlagSet("rpc")
+	var model modelFlags
+	model.register(fs)
+	fs.Parse(args)
+
+	nbt, err := model.load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing Farasa: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	if err := server.ServeRPC(context.Background(), nbt, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading requests: %v\n", err)
+		os.Exit(exitError)
+	}
+}
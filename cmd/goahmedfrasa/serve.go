@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"goahmedfrasa/pkg/goahmedfrasa/server"
+)
+
+// runServe implements "goahmedfrasa serve [flags]", which loads the model once
+// and serves the HTTP endpoints of package server until interrupted. The
+// health endpoints answer while the model is still loading.
+func runServe(args []string) {
+	fs := newFlagSet("serve")
+	var model modelFlags
+	model.register(fs)
+	addr := fs.String("addr", "localhost:8080", "Address to listen on")
+	fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := server.New(nil)
+	go func() {
+		nbt, err := model.load()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error initializing Farasa: %v\n", err)
+			os.Exit(exitError)
+		}
+		srv.SetFarasa(nbt)
+		fmt.Fprintf(os.Stderr, "Serving on %s\n", *addr)
+	}()
+	if err := srv.ListenAndServe(ctx, *addr); err != nil {
+		fmt.Fprintf(os.Stderr, "Error serving: %v\n", err)
+		os.Exit(exitError)
+	}
+}
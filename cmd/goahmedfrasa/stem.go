@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"goahmedfrasa/pkg/goahmedfrasa"
+)
+
+// tokenStem returns the stem morphemes of tok joined together
+func tokenStem(tok goahmedfrasa.Token) string {
+	var stem strings.Builder
+	for _, m := range tok.Morphemes {
+		if m.Role == goahmedfrasa.RoleStem {
+			stem.WriteString(m.Text)
+		}
+	}
+	if stem.Len() == 0 {
+		return tok.Text
+	}
+	return stem.String()
+}
+
+// spelledStem returns the stem of tok as it is spelled, before normalization,
+// which is what templates are matched on
+func spelledStem(nbt *goahmedfrasa.Farasa, tok goahmedfrasa.Token) string {
+	tokens, _ := nbt.SegmentWith(tok.Text, goahmedfrasa.SegmentOptions{NoNormalize: true})
+	if len(tokens) == 0 {
+		return tok.Text
+	}
+	return tokenStem(tokens[0])
+}
+
+// runStem implements "goahmedfrasa stem [flags]"
+func runStem(args []string) {
+	runWordCommand("stem", args, func(_ *goahmedfrasa.Farasa, tok goahmedfrasa.Token) string {
+		return tokenStem(tok)
+	})
+}
+
+// runRoot implements "goahmedfrasa root [flags]"
+func runRoot(args []string) {
+	runWordCommand("root", args, func(nbt *goahmedfrasa.Farasa, tok goahmedfrasa.Token) string {
+		if _, root := nbt.FitTemplate(spelledStem(nbt, tok)); root != "" {
+			return goahmedfrasa.RootToUTF8(root)
+		}
+		return tokenStem(tok)
+	})
+}
+
+// runTemplate implements "goahmedfrasa template [flags]"
+func runTemplate(args []string) {
+	runWordCommand("template", args, func(nbt *goahmedfrasa.Farasa, tok goahmedfrasa.Token) string {
+		template, _ := nbt.FitTemplate(spelledStem(nbt, tok))
+		return template
+	})
+}
+
+// runWordCommand runs a subcommand that segments its input and prints word(tok)
+// for every token, in the format of segment
+func runWordCommand(name string, args []string, word func(*goahmedfrasa.Farasa, goahmedfrasa.Token) string) {
+	fs := newFlagSet(name)
+	var files ioFlags
+	files.register(fs)
+	normFlag := fs.Bool("n", true, "Normalization (true/false)")
+	jobs := fs.Int("j", 1, "Number of lines processed in parallel")
+	var model modelFlags
+	model.register(fs)
+	fs.Parse(args)
+
+	nbt, err := model.load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing Farasa: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	reader, writer, closeFiles := files.open()
+	defer closeFiles()
+	opts := goahmedfrasa.SegmentOptions{NoNormalize: !*normFlag}
+	if _, err := processLines(reader, writer, *jobs, func(line string, out *bytes.Buffer) int {
+		tokens, _ := nbt.SegmentWith(line, opts)
+		for _, tok := range tokens {
+			out.WriteString(word(nbt, tok) + " ")
+		}
+		out.WriteString("\n")
+		return len(tokens)
+	}); err != nil {
+		closeFiles()
+		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+		os.Exit(exitError)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"goahmedfrasa/pkg/goahmedfrasa"
+)
+
+// runNormalize implements "goahmedfrasa normalize [flags]"
+func runNormalize(args []string) {
+	fs := newFlagSet("normalize")
+	var files ioFlags
+	files.register(fs)
+	fs.Parse(args)
+
+	runTextCommand(files, func(line string, out *bytes.Buffer) int {
+		words := strings.Fields(line)
+		for i, w := range words {
+			words[i] = goahmedfrasa.NormalizeFull(w)
+		}
+		out.WriteString(strings.Join(words, " ") + "\n")
+		return len(words)
+	})
+}
+
+// runTranslit implements "goahmedfrasa translit [flags]"
+func runTranslit(args []string) {
+	fs := newFlagSet("translit")
+	var files ioFlags
+	files.register(fs)
+	to := fs.String("to", "buckwalter", "Script to convert to: buckwalter or arabic")
+	fs.Parse(args)
+
+	var convert func(string) string
+	switch *to {
+	case "buckwalter":
+		convert = goahmedfrasa.UTF82Buck
+	case "arabic":
+		convert = goahmedfrasa.Buck2UTF8
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown -to %q, expected buckwalter or arabic\n", *to)
+		os.Exit(exitUsage)
+	}
+	runTextCommand(files, func(line string, out *bytes.Buffer) int {
+		out.WriteString(convert(line) + "\n")
+		return 0
+	})
+}
+
+// runTextCommand copies the input to the output line by line through format,
+// without loading the model
+func runTextCommand(files ioFlags, format func(string, *bytes.Buffer) int) {
+	reader, writer, closeFiles := files.open()
+	defer closeFiles()
+	if _, err := processLines(reader, writer, 1, format); err != nil {
+		closeFiles()
+		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+		os.Exit(exitError)
+	}
+}
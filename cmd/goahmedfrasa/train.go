@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"goahmedfrasa/pkg/goahmedfrasa"
+)
+
+// runTrain implements "goahmedfrasa train -i gold.txt [flags]", which learns
+// scoring weights from a gold corpus, fits the n-best temperature or exports
+// the candidate features
+func runTrain(args []string) {
+	fs := newFlagSet("train")
+	var model modelFlags
+	model.register(fs)
+	goldFile := fs.String("i", "", "Gold segmented corpus")
+	outputFile := fs.String("o", "weights.txt", "Output weights file path")
+	scheme := fs.String("c", "", "Segmentation scheme of the gold corpus (atb)")
+	defaults := goahmedfrasa.DefaultTrainOptions()
+	epochs := fs.Int("epochs", defaults.Epochs, "Number of passes over the training words")
+	heldOut := fs.Float64("heldout", defaults.HeldOut, "Fraction of words kept aside to measure accuracy, 0 to train on every word")
+	rate := fs.Float64("rate", defaults.LearningRate, "Learning rate")
+	seed := fs.Int64("seed", 1, "Random seed for the split and the training order")
+	calibrate := fs.Bool("calibrate", false, "Only fit the n-best temperature of the -w weights on the whole corpus")
+	svmlight := fs.String("svmlight", "", "Write the candidate features in SVM-light format to this file instead of training")
+	fs.Parse(args)
+
+	if *goldFile == "" {
+		fmt.Fprintln(os.Stderr, "train needs a gold corpus given with -i")
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	opts := goahmedfrasa.TrainOptions{
+		Epochs:       *epochs,
+		HeldOut:      *heldOut,
+		LearningRate: *rate,
+		Scheme:       *scheme,
+		Seed:         *seed,
+	}
+	if err := opts.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Bad training options: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	// the SeenBefore dictionary bypasses the scorer, so it plays no part here,
+	// and -w gives the weights to start from
+	nbt, err := model.load(goahmedfrasa.WithoutSeenBefore())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing Farasa: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	in, err := os.Open(*goldFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening gold corpus: %v\n", err)
+		os.Exit(exitError)
+	}
+	defer in.Close()
+
+	if *calibrate {
+		t, err := nbt.Calibrate(in, *scheme)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error calibrating: %v\n", err)
+			os.Exit(exitError)
+		}
+		fmt.Printf("%g\n", t)
+		return
+	}
+
+	if *svmlight != "" {
+		exportFeatures(nbt, in, *svmlight, *scheme)
+		return
+	}
+
+	res, err := nbt.Train(in, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error training: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	fmt.Fprintf(os.Stderr, "%d words, %d ambiguous: %d for training, %d held out\n", res.Words, res.Ambiguous, res.Train, res.HeldOut)
+	if res.HeldOut > 0 {
+		fmt.Fprintf(os.Stderr, "held-out gold among candidates: %.2f%%\n", 100*float64(res.Reachable)/float64(res.HeldOut))
+		fmt.Fprintf(os.Stderr, "held-out accuracy: %.2f%% (starting weights: %.2f%%)\n", 100*res.Accuracy, 100*res.BaselineAccuracy)
+		fmt.Fprintf(os.Stderr, "calibrated temperature: %g (use with -t)\n", res.Temperature)
+	}
+
+	out, err := os.Create(*outputFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+		os.Exit(exitError)
+	}
+	writer := bufio.NewWriter(out)
+	if err := goahmedfrasa.WriteWeights(writer, res.Weights); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing weights: %v\n", err)
+		os.Exit(exitError)
+	}
+	if err := writer.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing weights: %v\n", err)
+		os.Exit(exitError)
+	}
+	if err := out.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing weights: %v\n", err)
+		os.Exit(exitError)
+	}
+}
+
+// exportFeatures writes the SVM-light dump of the gold corpus to path
+func exportFeatures(nbt *goahmedfrasa.Farasa, in *os.File, path, scheme string) {
+	out, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+		os.Exit(exitError)
+	}
+	queries, err := nbt.ExportFeatures(in, out, scheme)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error exporting features: %v\n", err)
+		os.Exit(exitError)
+	}
+	if err := out.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing features: %v\n", err)
+		os.Exit(exitError)
+	}
+	fmt.Fprintf(os.Stderr, "%d queries written to %s\n", queries, path)
+}
@@ -0,0 +1,69 @@
+//go:build cgo && linux
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/partitions.golden")
+
+// TestCLibrary builds the shared library, compiles testdata/segment.c against
+// it and compares its segmentation of testdata/partitions.txt, with the
+// dictionary fixture of testdata/data, with testdata/partitions.golden
+func TestCLibrary(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the shared library")
+	}
+	gcc, err := exec.LookPath("gcc")
+	if err != nil {
+		t.Skip("gcc not found")
+	}
+	dataDir, err := filepath.Abs("../../testdata/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	run := func(cmd *exec.Cmd) []byte {
+		t.Helper()
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", strings.Join(cmd.Args, " "), err, stderr.Bytes())
+		}
+		return out
+	}
+	run(exec.Command("go", "build", "-buildmode=c-shared", "-o", filepath.Join(dir, "libgoahmedfrasa.so"), "."))
+	run(exec.Command(gcc, "-o", filepath.Join(dir, "segment"), "testdata/segment.c", "-I"+dir, "-L"+dir, "-lgoahmedfrasa"))
+
+	input, err := os.Open("../../testdata/partitions.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer input.Close()
+	cmd := exec.Command(filepath.Join(dir, "segment"), dataDir+string(filepath.Separator))
+	cmd.Stdin = input
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+	got := run(cmd)
+
+	if *update {
+		if err := os.WriteFile("testdata/partitions.golden", got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile("testdata/partitions.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("segment output differs from partitions.golden:\n got %s\nwant %s", got, want)
+	}
+}
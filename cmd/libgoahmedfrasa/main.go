@@ -0,0 +1,97 @@
+//go:build cgo
+
+// Command libgoahmedfrasa builds the segmenter as a C shared library:
+//
+//	go build -buildmode=c-shared -o libgoahmedfrasa.so ./cmd/libgoahmedfrasa
+//
+// which also writes the header libgoahmedfrasa.h declaring the functions below.
+//
+// Memory ownership: strings passed in remain owned by the caller and are not
+// retained after a call returns. The string returned by farasa_segment is
+// allocated with malloc and owned by the caller, who releases it with
+// farasa_free_string (or free from the same C runtime). A handle returned by
+// farasa_new is owned by the caller and released with farasa_free; it must not
+// be used afterwards. A handle may be used from several threads at once.
+package main
+
+/*
+#include <stdint.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"runtime/cgo"
+	"strings"
+	"unsafe"
+
+	"goahmedfrasa/pkg/goahmedfrasa"
+)
+
+// farasa_new loads the segmenter from a data directory or binary model file
+// and returns its handle, or 0 after printing the reason to stderr when
+// loading fails. A NULL or empty dir uses $FarasaDataDir, then data/.
+//
+//export farasa_new
+func farasa_new(dir *C.char) C.uintptr_t {
+	path := ""
+	if dir != nil {
+		path = C.GoString(dir)
+	}
+	if path == "" {
+		path = os.Getenv("FarasaDataDir")
+	}
+	if path == "" {
+		path = "data/"
+	}
+	f, err := goahmedfrasa.NewFarasa(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing Farasa: %v\n", err)
+		return 0
+	}
+	return C.uintptr_t(cgo.NewHandle(f))
+}
+
+// farasa_segment segments the UTF-8 text and returns the segmented words
+// separated by single spaces, with normalization and the default scheme, as a
+// new string the caller frees with farasa_free_string. Line breaks count as
+// spaces. Returns NULL when handle is 0 or text is NULL.
+//
+//export farasa_segment
+func farasa_segment(handle C.uintptr_t, text *C.char) *C.char {
+	if handle == 0 || text == nil {
+		return nil
+	}
+	f := cgo.Handle(handle).Value().(*goahmedfrasa.Farasa)
+	tokens, _ := f.SegmentWith(C.GoString(text), goahmedfrasa.SegmentOptions{})
+	words := make([]string, len(tokens))
+	for i, tok := range tokens {
+		words[i] = tok.Segmented
+	}
+	return C.CString(strings.Join(words, " "))
+}
+
+// farasa_free_string frees a string returned by farasa_segment. NULL is
+// ignored.
+//
+//export farasa_free_string
+func farasa_free_string(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
+
+// farasa_free releases the segmenter of a handle returned by farasa_new. 0 is
+// ignored.
+//
+//export farasa_free
+func farasa_free(handle C.uintptr_t) {
+	if handle == 0 {
+		return
+	}
+	h := cgo.Handle(handle)
+	h.Value().(*goahmedfrasa.Farasa).Close()
+	h.Delete()
+}
+
+func main() {}
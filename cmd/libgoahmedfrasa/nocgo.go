@@ -0,0 +1,15 @@
+//go:build !cgo
+
+// Command libgoahmedfrasa builds the segmenter as a C shared library, which
+// needs cgo. Without it only this stub is built.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Fprintln(os.Stderr, "libgoahmedfrasa must be built with cgo enabled and -buildmode=c-shared")
+	os.Exit(1)
+}
@@ -0,0 +1,57 @@
+/*
+ * Test program for libgoahmedfrasa: segments every line of stdin with the
+ * model given as the first argument and prints one segmented line per input
+ * line. Exits with status 1 when the library does not behave as documented.
+ *
+ *   go build -buildmode=c-shared -o libgoahmedfrasa.so ./cmd/libgoahmedfrasa
+ *   gcc -o segment cmd/libgoahmedfrasa/testdata/segment.c -I. -L. -lgoahmedfrasa
+ *   LD_LIBRARY_PATH=. ./segment ./data/ < testdata/partitions.txt
+ */
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+#include "libgoahmedfrasa.h"
+
+int main(int argc, char **argv) {
+	if (argc != 2) {
+		fprintf(stderr, "usage: %s data-dir-or-model < input\n", argv[0]);
+		return 2;
+	}
+
+	/* invalid arguments are reported, not crashed on */
+	if (farasa_new("/nonexistent/farasa") != 0) {
+		fprintf(stderr, "farasa_new accepted a missing directory\n");
+		return 1;
+	}
+	if (farasa_segment(0, "text") != NULL) {
+		fprintf(stderr, "farasa_segment accepted handle 0\n");
+		return 1;
+	}
+	farasa_free(0);
+	farasa_free_string(NULL);
+
+	uintptr_t farasa = farasa_new(argv[1]);
+	if (farasa == 0) {
+		return 1;
+	}
+	if (farasa_segment(farasa, NULL) != NULL) {
+		fprintf(stderr, "farasa_segment accepted NULL text\n");
+		return 1;
+	}
+
+	char line[65536];
+	while (fgets(line, sizeof line, stdin) != NULL) {
+		line[strcspn(line, "\r\n")] = '\0';
+		char *segmented = farasa_segment(farasa, line);
+		if (segmented == NULL) {
+			fprintf(stderr, "farasa_segment failed\n");
+			return 1;
+		}
+		printf("%s\n", segmented);
+		farasa_free_string(segmented);
+	}
+
+	farasa_free(farasa);
+	return 0;
+}
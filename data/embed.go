@@ -0,0 +1,16 @@
+//go:build farasa_embed
+
+// Package data embeds the Farasa dictionaries so that binaries built with the
+// farasa_embed tag do not need a data directory at run time.
+package data
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed *.json *.txt
+var files embed.FS
+
+// FS holds the embedded dictionaries, ready for goahmedfrasa.NewFarasaFS
+var FS fs.FS = files
@@ -0,0 +1,10 @@
+//go:build !farasa_embed
+
+// Package data embeds the Farasa dictionaries so that binaries built with the
+// farasa_embed tag do not need a data directory at run time.
+package data
+
+import "io/fs"
+
+// FS is nil unless the binary is built with the farasa_embed tag
+var FS fs.FS
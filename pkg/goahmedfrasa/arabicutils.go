@@ -90,6 +90,17 @@ func Buck2Morph(input string) string {
 	return replaceChars(input, buck, morph)
 }
 
+// morphToBuck undoes the two letters Buck2Morph changes without merging them
+// with others
+var morphToBuck = strings.NewReplacer("P", "$", "O", "*")
+
+// RootToUTF8 converts a root returned by FitTemplate, which is spelled in the
+// letters of Buck2Morph, to UTF-8 Arabic. The hamza forms Buck2Morph merges
+// into alef come back as alef.
+func RootToUTF8(root string) string {
+	return Buck2UTF8(morphToBuck.Replace(root))
+}
+
 // UTF82Buck converts UTF-8 Arabic to Buckwalter transliteration
 func UTF82Buck(input string) string {
 	ar := "\u0627\u0625\u0622\u0623\u0621\u0628\u062a\u062b\u062c\u062d\u062e\u062f\u0630\u0631\u0632\u0633\u0634\u0635\u0636\u0637\u0638\u0639\u063a\u0641\u0642\u0643\u0644\u0645\u0646\u0647\u0648\u064a\u0649\u0629\u0624\u0626\u064e\u064b\u064f\u064c\u0650\u064d\u0652\u0651"
@@ -0,0 +1,30 @@
+package goahmedfrasa
+
+import "testing"
+
+func TestRootToUTF8(t *testing.T) {
+	for _, tc := range []struct{ root, want string }{
+		{"ktb", "كتب"},
+		{"Prb", "شرب"},
+		{"Ohb", "ذهب"},
+	} {
+		if got := RootToUTF8(tc.root); got != tc.want {
+			t.Errorf("RootToUTF8(%q) = %q, want %q", tc.root, got, tc.want)
+		}
+	}
+}
+
+func TestFitTemplateRootArabic(t *testing.T) {
+	f := newTestFarasa(t)
+	for _, tc := range []struct{ stem, template, root string }{
+		// mshrwb, drink: sheen is P in the roots
+		{"مشروب", "mfEwl", "شرب"},
+		// mdhhb, doctrine: thal is O in the roots
+		{"مذهب", "mfEl", "ذهب"},
+	} {
+		template, root := f.FitTemplate(tc.stem)
+		if template != tc.template || RootToUTF8(root) != tc.root {
+			t.Errorf("FitTemplate(%s) = %s, %s (%s), want %s, %s", tc.stem, template, root, RootToUTF8(root), tc.template, tc.root)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package goahmedfrasa
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// SegmentBatch segments every text of texts like SegmentWith and returns the
+// tokens of texts[i] at index i. Words repeated across the batch are segmented
+// only once, and the distinct words are spread over GOMAXPROCS goroutines. When
+// ctx is done before all words are segmented, SegmentBatch returns nil and the
+// error of ctx.
+func (f *Farasa) SegmentBatch(ctx context.Context, texts []string, opts SegmentOptions) ([][]Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	words := make([][]string, len(texts))
+	index := make(map[string]int)
+	var unique []string
+	for i, text := range texts {
+		words[i] = Tokenize(RemoveDiacritics(text))
+		for _, w := range words[i] {
+			if _, ok := index[w]; !ok {
+				index[w] = len(unique)
+				unique = append(unique, w)
+			}
+		}
+	}
+
+	segmented := make([]Token, len(unique))
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for n := 0; n < runtime.GOMAXPROCS(0); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				segmented[i] = f.segmentToken(unique[i], opts)
+			}
+		}()
+	}
+	var err error
+feed:
+	for i := range unique {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([][]Token, len(texts))
+	for i := range texts {
+		out[i] = make([]Token, len(words[i]))
+		for j, w := range words[i] {
+			tok := segmented[index[w]]
+			tok.Morphemes = append([]Morpheme(nil), tok.Morphemes...)
+			out[i][j] = tok
+		}
+	}
+	return out, nil
+}
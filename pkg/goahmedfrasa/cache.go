@@ -0,0 +1,64 @@
+package goahmedfrasa
+
+import (
+	"hash/maphash"
+	"sync"
+)
+
+const cacheShards = 64
+
+// shardedCache is a bounded map from strings to values that is safe for
+// concurrent use. Keys are spread over independently locked shards so that
+// goroutines working on different words rarely contend. When a shard is full an
+// arbitrary entry is dropped to make room.
+type shardedCache[V any] struct {
+	seed     maphash.Seed
+	perShard int
+	shards   [cacheShards]cacheShard[V]
+}
+
+type cacheShard[V any] struct {
+	mu sync.RWMutex
+	m  map[string]V
+}
+
+// newShardedCache returns a cache holding roughly size entries. A size of zero
+// or less disables the cache.
+func newShardedCache[V any](size int) *shardedCache[V] {
+	c := &shardedCache[V]{seed: maphash.MakeSeed()}
+	if size > 0 {
+		c.perShard = (size + cacheShards - 1) / cacheShards
+	}
+	for i := range c.shards {
+		c.shards[i].m = make(map[string]V)
+	}
+	return c
+}
+
+func (c *shardedCache[V]) shard(key string) *cacheShard[V] {
+	return &c.shards[maphash.String(c.seed, key)%cacheShards]
+}
+
+func (c *shardedCache[V]) get(key string) (V, bool) {
+	s := c.shard(key)
+	s.mu.RLock()
+	v, ok := s.m[key]
+	s.mu.RUnlock()
+	return v, ok
+}
+
+func (c *shardedCache[V]) put(key string, v V) {
+	if c.perShard == 0 {
+		return
+	}
+	s := c.shard(key)
+	s.mu.Lock()
+	if _, ok := s.m[key]; !ok && len(s.m) >= c.perShard {
+		for k := range s.m {
+			delete(s.m, k)
+			break
+		}
+	}
+	s.m[key] = v
+	s.mu.Unlock()
+}
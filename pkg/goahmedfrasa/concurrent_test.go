@@ -0,0 +1,112 @@
+package goahmedfrasa
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testCorpus returns the lines of the text corpora in testdata
+func testCorpus(tb testing.TB) []string {
+	tb.Helper()
+	return testLines(tb, "partitions.txt", "ties.txt")
+}
+
+// testLines returns the non-empty lines of the named files of testdata
+func testLines(tb testing.TB, names ...string) []string {
+	tb.Helper()
+	var lines []string
+	for _, name := range names {
+		data, err := os.ReadFile("../../testdata/" + name)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+	return lines
+}
+
+// segmented formats tokens for comparison
+func segmented(tokens []Token) string {
+	out := make([]string, len(tokens))
+	for i, tok := range tokens {
+		out[i] = tok.Segmented
+	}
+	return strings.Join(out, " ")
+}
+
+// TestConcurrentUse segments the corpus from many goroutines through every
+// entry point sharing the caches, which are kept small so entries are evicted
+// while others read them. Run with -race. Every result must match the one of
+// an instance used from a single goroutine.
+func TestConcurrentUse(t *testing.T) {
+	want := newTestFarasa(t)
+	f := newTestFarasa(t, WithCacheSize(16), WithTemplateCacheSize(16))
+	lines := testCorpus(t)
+	opts := []SegmentOptions{{}, {Scheme: "atb"}, {NoNormalize: true}}
+
+	type result struct{ segmented, nbest, explain string }
+	reference := func(f *Farasa, line string, o SegmentOptions) result {
+		tokens, _ := f.SegmentWith(line, o)
+		var nbest, explain strings.Builder
+		for _, tok := range tokens {
+			for _, c := range f.NBest(tok.Text, 3, o) {
+				fmt.Fprintf(&nbest, "%s %.9f;", c.Segmented, c.Probability)
+			}
+			e := f.Explain(tok.Text)
+			fmt.Fprintf(&explain, "%s %d;", e.Segmentation, len(e.Candidates))
+			f.SeenBefore(tok.Text)
+		}
+		return result{segmented(tokens), nbest.String(), explain.String()}
+	}
+	expected := make(map[string]result)
+	for _, line := range lines {
+		for _, o := range opts {
+			expected[line+"\x00"+o.Scheme+fmt.Sprint(o.NoNormalize)] = reference(want, line, o)
+		}
+	}
+
+	const goroutines = 16
+	var wg sync.WaitGroup
+	errs := make(chan string, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for round := 0; round < 3; round++ {
+				for i := range lines {
+					line := lines[(i+g)%len(lines)]
+					o := opts[(i+g+round)%len(opts)]
+					got := reference(f, line, o)
+					if w := expected[line+"\x00"+o.Scheme+fmt.Sprint(o.NoNormalize)]; got != w {
+						errs <- fmt.Sprintf("%q with %+v: got %+v, want %+v", line, o, got, w)
+						return
+					}
+				}
+				batch, err := f.SegmentBatch(context.Background(), lines, SegmentOptions{})
+				if err != nil {
+					errs <- err.Error()
+					return
+				}
+				for i, tokens := range batch {
+					if got, w := segmented(tokens), expected[lines[i]+"\x00false"].segmented; got != w {
+						errs <- fmt.Sprintf("SegmentBatch %q: got %q, want %q", lines[i], got, w)
+						return
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
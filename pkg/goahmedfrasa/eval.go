@@ -0,0 +1,63 @@
+package goahmedfrasa
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// EvalResult reports the outcome of Evaluate
+type EvalResult struct {
+	// Words is the number of gold words read
+	Words int
+	// Correct is the number of words segmented like the gold
+	Correct int
+	// Accuracy is Correct / Words, 0 without words
+	Accuracy float64
+	// Errors lists the words segmented differently from the gold, in corpus
+	// order
+	Errors []EvalError
+}
+
+// EvalError is a word Evaluate segmented differently from the gold
+type EvalError struct {
+	Gold      string
+	Segmented string
+}
+
+// Evaluate segments every word of a gold corpus, see Train for its format, the
+// way SegmentWith would with the given scheme, and compares the result with
+// the normalized gold segmentation. Unlike the accuracy reported by Train, it
+// counts every word, including those answered by the SeenBefore dictionary and
+// those with a single candidate.
+func (f *Farasa) Evaluate(ctx context.Context, gold io.Reader, scheme string) (*EvalResult, error) {
+	golds, err := readGoldWords(gold)
+	if err != nil {
+		return nil, err
+	}
+	words := make([]string, len(golds))
+	for i, g := range golds {
+		words[i] = strings.ReplaceAll(g, "+", "")
+	}
+	tokens, err := f.SegmentBatch(ctx, words, SegmentOptions{Scheme: scheme})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &EvalResult{Words: len(golds)}
+	for i, g := range golds {
+		var seg strings.Builder
+		for _, tok := range tokens[i] {
+			seg.WriteString(strings.ReplaceAll(tok.Segmented, " ", ""))
+		}
+		if seg.String() == NormalizeFull(g) {
+			res.Correct++
+		} else {
+			res.Errors = append(res.Errors, EvalError{Gold: g, Segmented: seg.String()})
+		}
+	}
+	if res.Words > 0 {
+		res.Accuracy = float64(res.Correct) / float64(res.Words)
+	}
+	return res, nil
+}
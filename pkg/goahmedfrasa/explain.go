@@ -0,0 +1,115 @@
+package goahmedfrasa
+
+import (
+	"math"
+	"strings"
+)
+
+// featureNames names the ScorePartition features in weight order
+var featureNames = [NumFeatures]string{
+	"prefixProb",
+	"suffixProb",
+	"stemWordCount",
+	"prefixSuffixProb",
+	"suffixPrefixProb",
+	"templateFit",
+	"inMorphList",
+	"inGazetteer",
+	"condPrefixProb",
+	"condSuffixProb",
+	"stemFirstSuffixWordCount",
+	"templateCount",
+	"stemLengthDiff",
+	"araLexCom",
+	"inBuckwalter",
+	"inLocations",
+	"inPeople",
+	"inStopWords",
+}
+
+// FeatureName returns the name of feature i, counted from 0 as in Features
+func FeatureName(i int) string {
+	if i < 0 || i >= NumFeatures {
+		return ""
+	}
+	return featureNames[i]
+}
+
+// FeatureContribution is the part one feature plays in the score of a
+// partition. Contribution is Value times Weight.
+type FeatureContribution struct {
+	Index        int     `json:"index"`
+	Name         string  `json:"name"`
+	Value        float64 `json:"value"`
+	Weight       float64 `json:"weight"`
+	Contribution float64 `json:"contribution"`
+}
+
+// ExplainedPartition is a candidate partition with the breakdown of its score
+type ExplainedPartition struct {
+	// Partition is the raw prefix;stem;suffix form
+	Partition string `json:"partition"`
+	Prefix    string `json:"prefix"`
+	Stem      string `json:"stem"`
+	Suffix    string `json:"suffix"`
+	// Template is what FitTemplate returns for the stem, "Y" if none fits
+	Template string                `json:"template"`
+	Score    float64               `json:"score"`
+	Features []FeatureContribution `json:"features"`
+}
+
+// Explanation tells how a word is segmented
+type Explanation struct {
+	Word string `json:"word"`
+	// Segmentation is what Segment uses for the word before normalization
+	Segmentation string `json:"segmentation"`
+	// SeenBefore is set when Segmentation comes from the SeenBefore
+	// dictionary, in which case the candidates were not consulted
+	SeenBefore bool `json:"seenBefore"`
+	// Candidates holds every candidate partition, best first
+	Candidates []ExplainedPartition `json:"candidates"`
+}
+
+// Explain scores every candidate partition of word and reports the value,
+// weight and contribution of each feature, for finding out why a word is
+// segmented the way it is
+func (f *Farasa) Explain(word string) Explanation {
+	word = strings.TrimSpace(word)
+	e := Explanation{Word: word}
+	if seg, ok := f.hmSeenBefore.get(word); ok {
+		e.Segmentation = cleanSegmentation(seg)
+		e.SeenBefore = true
+	} else {
+		e.Segmentation, _ = f.segmentWord(word)
+	}
+
+	solutions := f.MostLikelyPartition(Buck2UTF8(word), math.MaxInt)
+	for i := len(solutions) - 1; i >= 0; i-- {
+		e.Candidates = append(e.Candidates, f.explainPartition(solutions[i]))
+	}
+	return e
+}
+
+func (f *Farasa) explainPartition(sp ScoredPartition) ExplainedPartition {
+	parts := splitPartition(sp.partition)
+	x := f.PartitionFeatures(parts)
+	ep := ExplainedPartition{
+		Partition: sp.partition,
+		Prefix:    strings.TrimSpace(parts[0]),
+		Stem:      strings.TrimSpace(parts[1]),
+		Suffix:    strings.TrimSpace(parts[2]),
+		Score:     sp.score,
+		Features:  make([]FeatureContribution, NumFeatures),
+	}
+	ep.Template = f.fitTemplate(ep.Stem)
+	for i, v := range x {
+		ep.Features[i] = FeatureContribution{
+			Index:        i + 1,
+			Name:         featureNames[i],
+			Value:        v,
+			Weight:       f.weights[i],
+			Contribution: v * f.weights[i],
+		}
+	}
+	return ep
+}
@@ -0,0 +1,55 @@
+package goahmedfrasa
+
+import (
+	"math"
+	"sort"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	// without known tokenizations the candidates are the generated ones
+	f := newTestFarasa(t, WithoutPreviouslySeenTokenizations())
+	for _, word := range []string{"والكتاب", "كتابه", "بكتاب", "مشروب", "wAlktAb"} {
+		e := f.Explain(word)
+		partitions, ok := f.PartitionsWithinLimits(Buck2UTF8(word))
+		if !ok {
+			t.Fatalf("%s: beyond the search limits", word)
+		}
+		var got []string
+		for _, c := range e.Candidates {
+			got = append(got, c.Partition)
+		}
+		sort.Strings(got)
+		sort.Strings(partitions)
+		if len(got) != len(partitions) {
+			t.Fatalf("%s: candidates %q, want %q", word, got, partitions)
+		}
+		for i := range got {
+			if got[i] != partitions[i] {
+				t.Errorf("%s: candidates %q, want %q", word, got, partitions)
+				break
+			}
+		}
+
+		for i, c := range e.Candidates {
+			if i > 0 && c.Score > e.Candidates[i-1].Score {
+				t.Errorf("%s: candidate %d scores above %d", word, i, i-1)
+			}
+			if len(c.Features) != NumFeatures {
+				t.Fatalf("%s %s: %d features", word, c.Partition, len(c.Features))
+			}
+			x := f.PartitionFeatures(splitPartition(c.Partition))
+			sum := 0.0
+			for j, fc := range c.Features {
+				want := FeatureContribution{j + 1, featureNames[j], x[j], f.weights[j], x[j] * f.weights[j]}
+				if fc != want {
+					t.Errorf("%s %s: feature %d is %+v, want %+v", word, c.Partition, j, fc, want)
+				}
+				sum += fc.Contribution
+			}
+			if math.Abs(sum-c.Score) > 1e-9 {
+				t.Errorf("%s %s: contributions add up to %v, score %v", word, c.Partition, sum, c.Score)
+			}
+		}
+	}
+}
@@ -3,90 +3,186 @@ package goahmedfrasa
 import (
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"math"
 	"os"
 	"regexp"
 	"sort"
-	"strconv"
 	"strings"
 )
 
-// Farasa is the core Arabic segmentation engine
+// Farasa is the core Arabic segmentation engine. It is safe for concurrent use
+// by multiple goroutines.
 type Farasa struct {
-	hmPreviouslySeenTokenizations map[string][]string
+	*model
+	ft          *FitTemplateClass
+	weights     []float64
+	temperature float64
+	search      searchLimits
+	// validAffixes is set by WithValidAffixes
+	validAffixes bool
+	cache        *shardedCache[cachedSegmentation]
+	// templates remembers what FitTemplate returned for recently scored stems
+	templates *shardedCache[string]
+	unmap     func() error
+}
+
+// model holds the dictionaries loaded from the data directory. It is never
+// modified after loading, so it can be read from any number of goroutines.
+type model struct {
+	hmPreviouslySeenTokenizations listTable
 	hmWordPossibleSplits          map[string][]string
-	hmListMorph                   map[string]int
-	hmListGaz                     map[string]int
-	hmAraLexCom                   map[string]int
-	hmBuck                        map[string]int
-	hmLocations                   map[string]int
-	hmPeople                      map[string]int
-	hmStop                        map[string]int
+	hmListMorph                   setTable
+	hmListGaz                     setTable
+	hmAraLexCom                   setTable
+	hmBuck                        setTable
+	hmLocations                   setTable
+	hmPeople                      setTable
+	hmStop                        setTable
 	hPrefixes                     map[string]int
 	hSuffixes                     map[string]int
+	maxPrefixLen                  int
+	maxSuffixLen                  int
 	hmValidSuffixes               map[string]bool
 	hmValidPrefixes               map[string]bool
-	hmTemplateCount               map[string]float64
-	HmSeenBefore                  map[string]string
+	hmTemplateCount               floatTable
+	hmSeenBefore                  stringTable
 	hmValidSuffixesSegmented      map[string]bool
 	hmValidPrefixesSegmented      map[string]bool
-	wordCount                     map[string]float64
-	probPrefixes                  map[string]float64
-	probSuffixes                  map[string]float64
-	probCondPrefixes              map[string]float64
-	probCondSuffixes              map[string]float64
+	wordCount                     floatTable
+	probPrefixes                  floatTable
+	probSuffixes                  floatTable
+	probCondPrefixes              floatTable
+	probCondSuffixes              floatTable
 	seenTemplates                 map[string]float64
-	probPrefixSuffix              map[string]map[string]float64
-	probSuffixPrefix              map[string]map[string]float64
+	probPrefixSuffix              pairTable
+	probSuffixPrefix              pairTable
 	generalVariables              map[string]float64
-	ft                            *FitTemplateClass
 }
 
-// NewFarasa creates a new Farasa instance and loads all data
-func NewFarasa(dataDir string) (*Farasa, error) {
-	f := &Farasa{
-		hmPreviouslySeenTokenizations: make(map[string][]string),
+// cachedSegmentation is a segmentation computed at run time
+type cachedSegmentation struct {
+	segmentation string
+	score        float64
+}
+
+// defaultCacheSize bounds the number of segmentations remembered at run time
+const defaultCacheSize = 1 << 18
+
+// defaultTemplateCacheSize bounds the number of stems whose template is
+// remembered
+const defaultTemplateCacheSize = 1 << 16
+
+// NewFarasa creates a new Farasa instance and loads all data. dataDir is either
+// a directory holding the JSON dictionaries or a binary model file written by
+// ConvertData. opts adjust which dictionaries are loaded and how words are
+// scored.
+func NewFarasa(dataDir string, opts ...Option) (*Farasa, error) {
+	if st, err := os.Stat(dataDir); err == nil && st.Mode().IsRegular() {
+		cfg, err := newConfig(opts)
+		if err != nil {
+			return nil, err
+		}
+		m, ft, err := loadModelFile(dataDir, cfg.skip)
+		if err != nil {
+			return nil, fmt.Errorf("loading model file: %w", err)
+		}
+		return newFarasa(m, ft, cfg), nil
+	}
+
+	return NewFarasaFS(dirFS(dataDir), opts...)
+}
+
+// NewFarasaFS creates a new Farasa instance from the JSON and text dictionaries
+// at the root of fsys, such as an embed.FS, a zip archive or an in-memory
+// fixture
+func NewFarasaFS(fsys fs.FS, opts ...Option) (*Farasa, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	m := &model{
+		hmPreviouslySeenTokenizations: listMap{},
 		hmWordPossibleSplits:          make(map[string][]string),
-		hmListMorph:                   make(map[string]int),
-		hmListGaz:                     make(map[string]int),
-		hmAraLexCom:                   make(map[string]int),
-		hmBuck:                        make(map[string]int),
-		hmLocations:                   make(map[string]int),
-		hmPeople:                      make(map[string]int),
-		hmStop:                        make(map[string]int),
+		hmListMorph:                   intMap{},
+		hmListGaz:                     intMap{},
+		hmAraLexCom:                   intMap{},
+		hmBuck:                        intMap{},
+		hmLocations:                   intMap{},
+		hmPeople:                      intMap{},
+		hmStop:                        intMap{},
 		hPrefixes:                     make(map[string]int),
 		hSuffixes:                     make(map[string]int),
 		hmValidSuffixes:               make(map[string]bool),
 		hmValidPrefixes:               make(map[string]bool),
-		hmTemplateCount:               make(map[string]float64),
-		HmSeenBefore:                  make(map[string]string),
+		hmTemplateCount:               floatMap{},
+		hmSeenBefore:                  stringMap{},
 		hmValidSuffixesSegmented:      make(map[string]bool),
 		hmValidPrefixesSegmented:      make(map[string]bool),
-		wordCount:                     make(map[string]float64),
-		probPrefixes:                  make(map[string]float64),
-		probSuffixes:                  make(map[string]float64),
-		probCondPrefixes:              make(map[string]float64),
-		probCondSuffixes:              make(map[string]float64),
+		wordCount:                     floatMap{},
+		probPrefixes:                  floatMap{},
+		probSuffixes:                  floatMap{},
+		probCondPrefixes:              floatMap{},
+		probCondSuffixes:              floatMap{},
 		seenTemplates:                 make(map[string]float64),
-		probPrefixSuffix:              make(map[string]map[string]float64),
-		probSuffixPrefix:              make(map[string]map[string]float64),
+		probPrefixSuffix:              nestedMap{},
+		probSuffixPrefix:              nestedMap{},
 		generalVariables:              make(map[string]float64),
 	}
 
-	var err error
-	f.ft, err = NewFitTemplateClass(dataDir)
+	ft, err := NewFitTemplateClassFS(fsys)
 	if err != nil {
 		return nil, fmt.Errorf("loading fit template: %w", err)
 	}
 
-	if err := f.loadStoredData(dataDir); err != nil {
+	if err := m.loadStoredData(skipFS{fsys, cfg.skip}); err != nil {
 		return nil, fmt.Errorf("loading stored data: %w", err)
 	}
-	return f, nil
+	return newFarasa(m, ft, cfg), nil
 }
 
-func loadJSONFile(path string, target interface{}) error {
-	data, err := os.ReadFile(path)
+// fillAffixes falls back to the built-in prefix and suffix lists when the data
+// directory does not provide them and notes the longest affixes
+func (m *model) fillAffixes() {
+	if len(m.hPrefixes) == 0 {
+		m.hPrefixes = make(map[string]int, len(Prefixes))
+		for _, p := range Prefixes {
+			m.hPrefixes[p] = 1
+		}
+	}
+	if len(m.hSuffixes) == 0 {
+		m.hSuffixes = make(map[string]int, len(Suffixes))
+		for _, s := range Suffixes {
+			m.hSuffixes[s] = 1
+		}
+	}
+	m.maxPrefixLen = maxKeyLength(m.hPrefixes)
+	m.maxSuffixLen = max(maxKeyLength(m.hSuffixes), 1)
+}
+
+// SeenBefore returns the segmentation stored for word in the SeenBefore
+// dictionary, or the one computed earlier by this instance
+func (f *Farasa) SeenBefore(word string) (string, bool) {
+	if seg, ok := f.hmSeenBefore.get(word); ok {
+		return seg, true
+	}
+	if c, ok := f.cache.get(word); ok {
+		return c.segmentation, true
+	}
+	return "", false
+}
+
+// dirFS returns the file system rooted at dataDir, which may or may not end
+// with a slash
+func dirFS(dataDir string) fs.FS {
+	if dataDir == "" {
+		dataDir = "."
+	}
+	return os.DirFS(dataDir)
+}
+
+func loadJSONFile(fsys fs.FS, name string, target interface{}) error {
+	data, err := fs.ReadFile(fsys, name)
 	if err != nil {
 		return err
 	}
@@ -94,141 +190,169 @@ func loadJSONFile(path string, target interface{}) error {
 }
 
 // loadJSONIntMap loads a map[string]int from a JSON file where values may be float64
-func loadJSONIntMap(path string) (map[string]int, error) {
+func loadJSONIntMap(fsys fs.FS, name string) (intMap, error) {
 	var raw map[string]float64
-	if err := loadJSONFile(path, &raw); err != nil {
+	if err := loadJSONFile(fsys, name, &raw); err != nil {
 		return nil, err
 	}
-	result := make(map[string]int, len(raw))
+	result := make(intMap, len(raw))
 	for k, v := range raw {
 		result[k] = int(v)
 	}
 	return result, nil
 }
 
-func (f *Farasa) loadStoredData(dataDir string) error {
+func loadJSONFloatMap(fsys fs.FS, name string) (floatMap, error) {
+	var m floatMap
+	if err := loadJSONFile(fsys, name, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *model) loadStoredData(fsys fs.FS) error {
 	var err error
 
 	// Load int maps
-	if f.hmListMorph, err = loadJSONIntMap(dataDir + "hmListMorph.json"); err != nil {
+	if m.hmListMorph, err = loadJSONIntMap(fsys, "hmListMorph.json"); err != nil {
 		return err
 	}
-	if f.hmListGaz, err = loadJSONIntMap(dataDir + "hmListGaz.json"); err != nil {
+	if m.hmListGaz, err = loadJSONIntMap(fsys, "hmListGaz.json"); err != nil {
 		return err
 	}
-	if f.hmAraLexCom, err = loadJSONIntMap(dataDir + "hmAraLexCom.json"); err != nil {
+	if m.hmAraLexCom, err = loadJSONIntMap(fsys, "hmAraLexCom.json"); err != nil {
 		return err
 	}
-	if f.hmBuck, err = loadJSONIntMap(dataDir + "hmBuck.json"); err != nil {
+	if m.hmBuck, err = loadJSONIntMap(fsys, "hmBuck.json"); err != nil {
 		return err
 	}
-	if f.hmLocations, err = loadJSONIntMap(dataDir + "hmLocations.json"); err != nil {
+	if m.hmLocations, err = loadJSONIntMap(fsys, "hmLocations.json"); err != nil {
 		return err
 	}
-	if f.hmPeople, err = loadJSONIntMap(dataDir + "hmPeople.json"); err != nil {
+	if m.hmPeople, err = loadJSONIntMap(fsys, "hmPeople.json"); err != nil {
 		return err
 	}
-	if f.hmStop, err = loadJSONIntMap(dataDir + "hmStop.json"); err != nil {
+	if m.hmStop, err = loadJSONIntMap(fsys, "hmStop.json"); err != nil {
 		return err
 	}
-	if f.hPrefixes, err = loadJSONIntMap(dataDir + "hPrefixes.json"); err != nil {
+	if m.hPrefixes, err = loadJSONIntMap(fsys, "hPrefixes.json"); err != nil {
 		return err
 	}
-	if f.hSuffixes, err = loadJSONIntMap(dataDir + "hSuffixes.json"); err != nil {
+	if m.hSuffixes, err = loadJSONIntMap(fsys, "hSuffixes.json"); err != nil {
 		return err
 	}
 
 	// Load bool maps
-	if err = loadJSONFile(dataDir+"hmValidSuffixes.json", &f.hmValidSuffixes); err != nil {
+	if err = loadJSONFile(fsys, "hmValidSuffixes.json", &m.hmValidSuffixes); err != nil {
 		return err
 	}
-	if err = loadJSONFile(dataDir+"hmValidPrefixes.json", &f.hmValidPrefixes); err != nil {
+	if err = loadJSONFile(fsys, "hmValidPrefixes.json", &m.hmValidPrefixes); err != nil {
 		return err
 	}
-	if err = loadJSONFile(dataDir+"hmValidSuffixesSegmented.json", &f.hmValidSuffixesSegmented); err != nil {
+	if err = loadJSONFile(fsys, "hmValidSuffixesSegmented.json", &m.hmValidSuffixesSegmented); err != nil {
 		return err
 	}
-	if err = loadJSONFile(dataDir+"hmValidPrefixesSegmented.json", &f.hmValidPrefixesSegmented); err != nil {
+	if err = loadJSONFile(fsys, "hmValidPrefixesSegmented.json", &m.hmValidPrefixesSegmented); err != nil {
 		return err
 	}
 
 	// Load double maps
-	if err = loadJSONFile(dataDir+"hmTemplateCount.json", &f.hmTemplateCount); err != nil {
+	if m.hmTemplateCount, err = loadJSONFloatMap(fsys, "hmTemplateCount.json"); err != nil {
 		return err
 	}
-	if err = loadJSONFile(dataDir+"wordCount.json", &f.wordCount); err != nil {
+	if m.wordCount, err = loadJSONFloatMap(fsys, "wordCount.json"); err != nil {
 		return err
 	}
-	if err = loadJSONFile(dataDir+"probPrefixes.json", &f.probPrefixes); err != nil {
+	if m.probPrefixes, err = loadJSONFloatMap(fsys, "probPrefixes.json"); err != nil {
 		return err
 	}
-	if err = loadJSONFile(dataDir+"probSuffixes.json", &f.probSuffixes); err != nil {
+	if m.probSuffixes, err = loadJSONFloatMap(fsys, "probSuffixes.json"); err != nil {
 		return err
 	}
-	if err = loadJSONFile(dataDir+"probCondPrefixes.json", &f.probCondPrefixes); err != nil {
+	if m.probCondPrefixes, err = loadJSONFloatMap(fsys, "probCondPrefixes.json"); err != nil {
 		return err
 	}
-	if err = loadJSONFile(dataDir+"probCondSuffixes.json", &f.probCondSuffixes); err != nil {
+	if m.probCondSuffixes, err = loadJSONFloatMap(fsys, "probCondSuffixes.json"); err != nil {
 		return err
 	}
-	if err = loadJSONFile(dataDir+"seenTemplates.json", &f.seenTemplates); err != nil {
+	if err = loadJSONFile(fsys, "seenTemplates.json", &m.seenTemplates); err != nil {
 		return err
 	}
-	if err = loadJSONFile(dataDir+"generalVariables.json", &f.generalVariables); err != nil {
+	if err = loadJSONFile(fsys, "generalVariables.json", &m.generalVariables); err != nil {
 		return err
 	}
 
 	// Load list maps
-	if err = loadJSONFile(dataDir+"hmPreviouslySeenTokenizations.json", &f.hmPreviouslySeenTokenizations); err != nil {
+	var tokenizations listMap
+	if err = loadJSONFile(fsys, "hmPreviouslySeenTokenizations.json", &tokenizations); err != nil {
 		return err
 	}
-	if err = loadJSONFile(dataDir+"hmWordPossibleSplits.json", &f.hmWordPossibleSplits); err != nil {
+	m.hmPreviouslySeenTokenizations = tokenizations
+	if err = loadJSONFile(fsys, "hmWordPossibleSplits.json", &m.hmWordPossibleSplits); err != nil {
 		return err
 	}
 
 	// Load nested maps
-	if err = loadJSONFile(dataDir+"probPrefixSuffix.json", &f.probPrefixSuffix); err != nil {
+	var probPrefixSuffix nestedMap
+	if err = loadJSONFile(fsys, "probPrefixSuffix.json", &probPrefixSuffix); err != nil {
 		return err
 	}
-	if err = loadJSONFile(dataDir+"probSuffixPrefix.json", &f.probSuffixPrefix); err != nil {
+	m.probPrefixSuffix = probPrefixSuffix
+	var probSuffixPrefix nestedMap
+	if err = loadJSONFile(fsys, "probSuffixPrefix.json", &probSuffixPrefix); err != nil {
 		return err
 	}
+	m.probSuffixPrefix = probSuffixPrefix
 
 	// Load seen before
-	if err = loadJSONFile(dataDir+"SeenBefore.json", &f.HmSeenBefore); err != nil {
+	var seenBefore stringMap
+	if err = loadJSONFile(fsys, "SeenBefore.json", &seenBefore); err != nil {
 		return err
 	}
+	m.hmSeenBefore = seenBefore
 
 	return nil
 }
 
 // ScorePartition scores a prefix;stem;suffix partition
 func (f *Farasa) ScorePartition(parts []string) float64 {
+	x := f.PartitionFeatures(parts)
+	return x.Score(f.weights)
+}
+
+// Features holds the values of the scoring features of one partition. The score
+// of a partition is their dot product with the weights.
+type Features [NumFeatures]float64
+
+// Score returns the dot product of x and weights
+func (x *Features) Score(weights []float64) float64 {
 	score := 0.0
+	for i, v := range x {
+		score += weights[i] * v
+	}
+	return score
+}
+
+// PartitionFeatures computes the scoring features of a prefix;stem;suffix
+// partition
+func (f *Farasa) PartitionFeatures(parts []string) Features {
+	var x Features
 	prefix := strings.TrimSpace(parts[0])
 	suffix := strings.TrimSpace(parts[2])
 	stem := strings.TrimSpace(parts[1])
 
-	magicNumbersStr := "1:-0.097825818 2:-0.03893654 3:0.13109569 4:0.18436976 5:0.11448806 6:0.53001714 7:0.21098258 8:-0.17760228 9:0.44223878 10:0.26183113 11:-0.05603376 12:0.055829503 13:-0.17745291 14:0.015865559 15:0.66909122 16:0.16948195 17:0.15397599 18:0.60355717"
-	magicParts := regexp.MustCompile(` +`).Split(magicNumbersStr, -1)
-	magicNo := make([]float64, len(magicParts))
-	for i, m := range magicParts {
-		idx := strings.Index(m, ":")
-		magicNo[i], _ = strconv.ParseFloat(m[idx+1:], 64)
-	}
-
 	// Feature 0: prefix probability
-	if v, ok := f.probPrefixes[prefix]; ok {
-		score += magicNo[0] * math.Log(v)
+	if v, ok := f.probPrefixes.get(prefix); ok {
+		x[0] = math.Log(v)
 	} else {
-		score += magicNo[0] * -10
+		x[0] = -10
 	}
 
 	// Feature 1: suffix probability
-	if v, ok := f.probSuffixes[suffix]; ok {
-		score += magicNo[1] * math.Log(v)
+	if v, ok := f.probSuffixes.get(suffix); ok {
+		x[1] = math.Log(v)
 	} else {
-		score += magicNo[1] * -10
+		x[1] = -10
 	}
 
 	trimmedTemp := strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(suffix, "+", ""), ";", ""), ",", "")
@@ -239,80 +363,73 @@ func (f *Farasa) ScorePartition(parts []string) float64 {
 
 	// Feature 2: stem word count
 	stemWordCount := -10.0
-	if v, ok := f.wordCount[stem]; ok {
+	if v, ok := f.wordCount.get(stem); ok {
 		stemWordCount = v
 	} else if len(altStem) > 1 {
-		if v, ok := f.wordCount[altStem]; ok {
+		if v, ok := f.wordCount.get(altStem); ok {
 			stemWordCount = v
 		}
 	}
-	score += magicNo[2] * stemWordCount
+	x[2] = stemWordCount
 
 	// Feature 3: prefix-suffix co-occurrence
-	if inner, ok := f.probPrefixSuffix[prefix]; ok {
-		if v, ok := inner[suffix]; ok {
-			score += magicNo[3] * math.Log(v)
-		} else {
-			score += magicNo[3] * -20
-		}
+	if v, ok := f.probPrefixSuffix.get(prefix, suffix); ok {
+		x[3] = math.Log(v)
 	} else {
-		score += magicNo[3] * -20
+		x[3] = -20
 	}
 
 	// Feature 4: suffix-prefix co-occurrence
-	if inner, ok := f.probSuffixPrefix[suffix]; ok {
-		if v, ok := inner[prefix]; ok {
-			score += magicNo[4] * math.Log(v)
-		} else {
-			score += magicNo[4] * -20
-		}
+	if v, ok := f.probSuffixPrefix.get(suffix, prefix); ok {
+		x[4] = math.Log(v)
 	} else {
-		score += magicNo[4] * -20
+		x[4] = -20
 	}
 
 	// Feature 5: template fit
-	if f.ft.FitTemplate(stem) != "Y" {
-		score += magicNo[5] * math.Log(f.generalVariables["hasTemplate"])
+	template := f.fitTemplate(stem)
+	if template != "Y" {
+		x[5] = math.Log(f.generalVariables["hasTemplate"])
 	} else {
-		score += magicNo[5] * math.Log(1-f.generalVariables["hasTemplate"])
+		x[5] = math.Log(1 - f.generalVariables["hasTemplate"])
 	}
 
 	// Feature 6: in morph list
-	_, inMorph := f.hmListMorph[stem]
+	inMorph := f.hmListMorph.has(stem)
 	if !inMorph && strings.HasSuffix(stem, "\u064a") {
 		runes := []rune(stem)
-		_, inMorph = f.hmListMorph[string(runes[:len(runes)-1])+"\u0649"]
+		inMorph = f.hmListMorph.has(string(runes[:len(runes)-1]) + "\u0649")
 	}
 	if inMorph {
-		score += magicNo[6] * math.Log(f.generalVariables["inMorphList"])
+		x[6] = math.Log(f.generalVariables["inMorphList"])
 	} else {
-		score += magicNo[6] * math.Log(1-f.generalVariables["inMorphList"])
+		x[6] = math.Log(1 - f.generalVariables["inMorphList"])
 	}
 
 	// Feature 7: in gazetteer list
-	_, inGaz := f.hmListGaz[stem]
+	inGaz := f.hmListGaz.has(stem)
 	if !inGaz && strings.HasSuffix(stem, "\u064a") {
 		runes := []rune(stem)
-		_, inGaz = f.hmListGaz[string(runes[:len(runes)-1])+"\u0649"]
+		inGaz = f.hmListGaz.has(string(runes[:len(runes)-1]) + "\u0649")
 	}
 	if inGaz {
-		score += magicNo[7] * math.Log(f.generalVariables["inGazList"])
+		x[7] = math.Log(f.generalVariables["inGazList"])
 	} else {
-		score += magicNo[7] * math.Log(1-f.generalVariables["inGazList"])
+		x[7] = math.Log(1 - f.generalVariables["inGazList"])
 	}
 
 	// Feature 8: conditional prefix probability
-	if v, ok := f.probCondPrefixes[prefix]; ok {
-		score += magicNo[8] * math.Log(v)
+	if v, ok := f.probCondPrefixes.get(prefix); ok {
+		x[8] = math.Log(v)
 	} else {
-		score += magicNo[8] * -20
+		x[8] = -20
 	}
 
 	// Feature 9: conditional suffix probability
-	if v, ok := f.probCondSuffixes[suffix]; ok {
-		score += magicNo[9] * math.Log(v)
+	if v, ok := f.probCondSuffixes.get(suffix); ok {
+		x[9] = math.Log(v)
 	} else {
-		score += magicNo[9] * -20
+		x[9] = -20
 	}
 
 	// Feature 10: stem + first suffix word count
@@ -327,34 +444,38 @@ func (f *Farasa) ScorePartition(parts []string) float64 {
 		stemPlusFirstSuffix += suffix
 	}
 	stemWordCount = -10.0
-	if v, ok := f.wordCount[stemPlusFirstSuffix]; ok {
+	if v, ok := f.wordCount.get(stemPlusFirstSuffix); ok {
 		stemWordCount = v
 	} else if strings.HasSuffix(stem, "\u064a") {
 		runes := []rune(stem)
 		alt := string(runes[:len(runes)-1]) + "\u0649"
-		if v, ok := f.wordCount[alt]; ok {
+		if v, ok := f.wordCount.get(alt); ok {
 			stemWordCount = v
 		}
 	}
 	if stemWordCount == -10 && strings.HasSuffix(stemPlusFirstSuffix, "\u062a") {
 		runes := []rune(stemPlusFirstSuffix)
 		alt := string(runes[:len(runes)-1]) + "\u0629"
-		if v, ok := f.wordCount[alt]; ok {
+		if v, ok := f.wordCount.get(alt); ok {
 			stemWordCount = v
 		}
 	}
-	score += magicNo[10] * stemWordCount
+	x[10] = stemWordCount
 
 	// Feature 11: template count
-	template := f.ft.FitTemplate(stem)
-	if v, ok := f.hmTemplateCount[template]; ok {
-		score += magicNo[11] * math.Log(v)
+	if v, ok := f.hmTemplateCount.get(template); ok {
+		x[11] = math.Log(v)
 	} else {
-		score += magicNo[11] * -10
+		x[11] = -10
 	}
 
-	// Feature 12: difference from average stem length
-	score += magicNo[12] * math.Log(math.Abs(float64(len([]rune(stem)))-f.generalVariables["averageStemLength"]))
+	// Feature 12: difference from average stem length, -20 for a stem of
+	// exactly that length, which WithGeneralVariables can make whole
+	if d := math.Abs(float64(len([]rune(stem))) - f.generalVariables["averageStemLength"]); d > 0 {
+		x[12] = math.Log(d)
+	} else {
+		x[12] = -20
+	}
 
 	// Feature 13: AraLexCom
 	trimmedTemp = strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(suffix, "+", ""), ";", ""), ",", "")
@@ -362,87 +483,87 @@ func (f *Farasa) ScorePartition(parts []string) float64 {
 	if strings.HasPrefix(trimmedTemp, "\u062a") && len([]rune(trimmedTemp)) > 1 {
 		altStem = stem + "\u0629"
 	}
-	if _, ok := f.hmAraLexCom[stem]; ok {
-		if v, ok := f.wordCount[stem]; ok {
-			score += magicNo[13] * v
+	if f.hmAraLexCom.has(stem) {
+		if v, ok := f.wordCount.get(stem); ok {
+			x[13] = v
 		} else {
-			score += magicNo[13] * -10
+			x[13] = -10
 		}
 	} else if strings.HasSuffix(stem, "\u064a") {
 		runes := []rune(stem)
 		alt := string(runes[:len(runes)-1]) + "\u0649"
-		if _, ok := f.hmAraLexCom[alt]; ok {
-			if v, ok := f.wordCount[alt]; ok {
-				score += magicNo[13] * v
+		if f.hmAraLexCom.has(alt) {
+			if v, ok := f.wordCount.get(alt); ok {
+				x[13] = v
 			} else {
-				score += magicNo[13] * -10
+				x[13] = -10
 			}
 		} else if len(strings.TrimSpace(altStem)) > 0 {
-			if _, ok := f.hmAraLexCom[altStem]; ok {
-				if v, ok := f.wordCount[altStem]; ok {
-					score += magicNo[13] * v
+			if f.hmAraLexCom.has(altStem) {
+				if v, ok := f.wordCount.get(altStem); ok {
+					x[13] = v
 				} else {
-					score += magicNo[13] * -10
+					x[13] = -10
 				}
 			} else {
-				score += magicNo[13] * -20
+				x[13] = -20
 			}
 		} else {
-			score += magicNo[13] * -20
+			x[13] = -20
 		}
 	} else if len(strings.TrimSpace(altStem)) > 0 {
-		if _, ok := f.hmAraLexCom[altStem]; ok {
-			if v, ok := f.wordCount[altStem]; ok {
-				score += magicNo[13] * v
+		if f.hmAraLexCom.has(altStem) {
+			if v, ok := f.wordCount.get(altStem); ok {
+				x[13] = v
 			} else {
-				score += magicNo[13] * -10
+				x[13] = -10
 			}
 		} else {
-			score += magicNo[13] * -20
+			x[13] = -20
 		}
 	} else {
-		score += magicNo[13] * -20
+		x[13] = -20
 	}
 
 	// Feature 14: in Buck list
-	_, inBuck := f.hmBuck[stem]
+	inBuck := f.hmBuck.has(stem)
 	if !inBuck && strings.HasSuffix(stem, "\u064a") {
 		runes := []rune(stem)
-		_, inBuck = f.hmBuck[string(runes[:len(runes)-1])+"\u0649"]
+		inBuck = f.hmBuck.has(string(runes[:len(runes)-1]) + "\u0649")
 	}
 	if inBuck {
-		score += magicNo[14]
+		x[14] = 1
 	} else {
-		score += -1 * magicNo[14]
+		x[14] = -1
 	}
 
 	// Feature 15: in locations list
-	if _, ok := f.hmLocations[stem]; ok {
-		score += magicNo[15]
+	if f.hmLocations.has(stem) {
+		x[15] = 1
 	} else {
-		score += -1 * magicNo[15]
+		x[15] = -1
 	}
 
 	// Feature 16: in people list
-	if _, ok := f.hmPeople[stem]; ok {
-		score += magicNo[16]
+	if f.hmPeople.has(stem) {
+		x[16] = 1
 	} else {
-		score += -1 * magicNo[16]
+		x[16] = -1
 	}
 
 	// Feature 17: in stop words list
-	_, inStop := f.hmStop[stem]
+	inStop := f.hmStop.has(stem)
 	if !inStop && strings.HasSuffix(stem, "\u064a") {
 		runes := []rune(stem)
-		_, inStop = f.hmStop[string(runes[:len(runes)-1])+"\u0649"]
+		inStop = f.hmStop.has(string(runes[:len(runes)-1]) + "\u0649")
 	}
 	if inStop {
-		score += magicNo[17]
+		x[17] = 1
 	} else {
-		score += -1 * magicNo[17]
+		x[17] = -1
 	}
 
-	return score
+	return x
 }
 
 // ScoredPartition holds a score and its corresponding partition string
@@ -461,45 +582,58 @@ func (sp ScoredPartition) GetScore() float64 {
 	return sp.score
 }
 
-// MostLikelyPartition returns the top N segmentations for a word
-func (f *Farasa) MostLikelyPartition(word string, numberOfSolutions int) []ScoredPartition {
-	word = strings.TrimSpace(word)
-	possiblePartitions := f.GetAllPossiblePartitionsOfString(word)
+// better reports whether sp ranks above other. Partitions are ranked by score.
+// Equal scores go to the partition with fewer morphemes and then to the
+// partition that sorts first bytewise, so the ranking depends neither on the
+// order candidates are generated in nor on the sort algorithm.
+func (sp ScoredPartition) better(other ScoredPartition) bool {
+	if sp.score != other.score {
+		return sp.score > other.score
+	}
+	if n, m := countMorphemes(sp.partition), countMorphemes(other.partition); n != m {
+		return n < m
+	}
+	return sp.partition < other.partition
+}
 
-	if strings.HasPrefix(word, "\u0644\u0644") {
-		possiblePartitions = append(possiblePartitions, f.GetAllPossiblePartitionsOfString("\u0644\u0627\u0644"+word[len("\u0644\u0644"):])...)
-	} else if strings.HasPrefix(word, "\u0648\u0644\u0644") {
-		possiblePartitions = append(possiblePartitions, f.GetAllPossiblePartitionsOfString("\u0648\u0644\u0627\u0644"+word[len("\u0648\u0644\u0644"):])...)
-	} else if strings.HasPrefix(word, "\u0641\u0644\u0644") {
-		possiblePartitions = append(possiblePartitions, f.GetAllPossiblePartitionsOfString("\u0641\u0644\u0627\u0644"+word[len("\u0641\u0644\u0644"):])...)
+// countMorphemes counts the non-empty pieces of a prefix;stem;suffix partition
+func countMorphemes(pp string) int {
+	return len(strings.FieldsFunc(pp, func(r rune) bool { return r == '+' || r == ';' }))
+}
+
+// FitTemplate returns the morphological template stem fits, "Y" if none does,
+// along with the root it was matched with in the transliteration of roots.txt,
+// which RootToUTF8 turns into Arabic letters
+func (f *Farasa) FitTemplate(stem string) (string, string) {
+	return f.ft.FitTemplateRoot(strings.TrimSpace(stem))
+}
+
+// fitTemplate is the template of FitTemplate for stems of candidate
+// partitions. The same stem turns up in many candidates and words, so the
+// results are cached.
+func (f *Farasa) fitTemplate(stem string) string {
+	if t, ok := f.templates.get(stem); ok {
+		return t
 	}
+	t := f.ft.FitTemplate(stem)
+	f.templates.put(stem, t)
+	return t
+}
 
+// MostLikelyPartition returns the top N segmentations for a word. Ties are
+// broken as described for better, so the result is the same on every run and
+// platform. Words beyond the search limits, see WithMaxSearchWordLength and
+// WithSearchBudget, get the single partition chosen by the Fallback.
+func (f *Farasa) MostLikelyPartition(word string, numberOfSolutions int) []ScoredPartition {
 	var scores []ScoredPartition
-
-	cleanWord := strings.ReplaceAll(word, "+", "")
-	if tokenizations, ok := f.hmPreviouslySeenTokenizations[cleanWord]; ok {
-		for _, p := range tokenizations {
-			pp := f.GetProperSegmentation(strings.ReplaceAll(p, ";", ""))
-			parts := strings.Split(" "+pp+" ", ";")
-			if len(parts) == 3 {
-				sc := f.ScorePartition(parts)
-				scores = append(scores, ScoredPartition{sc, pp})
-			}
-		}
-	} else {
-		for _, p := range possiblePartitions {
-			pp := f.GetProperSegmentation(strings.ReplaceAll(p, ";", ""))
-			parts := strings.Split(" "+pp+" ", ";")
-			if len(parts) == 3 {
-				sc := f.ScorePartition(parts)
-				scores = append(scores, ScoredPartition{sc, pp})
-			}
-		}
+	for _, pp := range f.candidates(word) {
+		sc := f.ScorePartition(splitPartition(pp))
+		scores = append(scores, ScoredPartition{sc, pp})
 	}
 
-	// Sort by score ascending (Java TreeMap order)
+	// Sort ascending, worst first as in the Java TreeMap
 	sort.Slice(scores, func(i, j int) bool {
-		return scores[i].score < scores[j].score
+		return scores[j].better(scores[i])
 	})
 
 	// Keep top N (last N in ascending order)
@@ -509,91 +643,92 @@ func (f *Farasa) MostLikelyPartition(word string, numberOfSolutions int) []Score
 	return scores
 }
 
-// GetAllPossiblePartitionsOfString generates all possible partitions of a string
-func (f *Farasa) GetAllPossiblePartitionsOfString(s string) []string {
-	var output []string
-	s = strings.TrimSpace(s)
-	if len(s) == 0 {
-		return output
-	}
-
-	runes := []rune(s)
-	fullPartition := string(runes[0:1])
-	for i := 1; i < len(runes); i++ {
-		fullPartition += "," + string(runes[i:i+1])
+// candidates returns the distinct prefix;stem;suffix partitions
+// MostLikelyPartition chooses from. Known tokenizations of the word replace the
+// generated ones.
+func (f *Farasa) candidates(word string) []string {
+	word = strings.TrimSpace(word)
+	cleanWord := strings.ReplaceAll(word, "+", "")
+	tokenizations, ok := f.hmPreviouslySeenTokenizations.get(cleanWord)
+	generated := false
+	if !ok && f.validAffixes {
+		tokenizations, ok = f.hmWordPossibleSplits[cleanWord]
+	}
+	if !ok {
+		tokenizations, ok = f.searchPartitions(word)
+		if !ok {
+			return []string{f.fallbackPartition(word)}
+		}
+		generated = true
 	}
 
-	correctFull := f.GetProperSegmentation(strings.ReplaceAll(regexp.MustCompile(`\++`).ReplaceAllString(strings.ReplaceAll(fullPartition, ",", "+"), "+"), "", ""))
-	// Hmm, let me redo this more carefully matching the Java
-	cleaned := strings.ReplaceAll(fullPartition, ",", "+")
-	cleaned = regexp.MustCompile(`\++`).ReplaceAllString(cleaned, "+")
-	correctFull = f.GetProperSegmentation(cleaned)
-
-	parts := strings.Split(" "+correctFull+" ", ";")
-	if !containsSlice(output, correctFull) {
-		if (len(parts) >= 2 && len(strings.TrimSpace(parts[1])) != 1) || len(runes) == 1 {
-			output = append(output, correctFull)
+	var output []string
+	seen := make(map[string]bool)
+	for _, p := range tokenizations {
+		pp := f.GetProperSegmentation(strings.ReplaceAll(p, ";", ""))
+		if len(splitPartition(pp)) == 3 && !seen[pp] {
+			seen[pp] = true
+			output = append(output, pp)
 		}
 	}
-
-	if strings.Contains(fullPartition, ",") {
-		output = f.getSubPartitions(fullPartition, output)
+	if generated && f.validAffixes {
+		output = f.withValidAffixes(output)
 	}
 	return output
 }
 
-func (f *Farasa) getSubPartitions(s string, output []string) []string {
-	if !strings.Contains(s, ",") {
-		return output
-	}
-	parts := strings.Split(s, ",")
-	for i := 0; i < len(parts)-1; i++ {
-		var ss string
-		for j := 0; j < i; j++ {
-			if j == 0 {
-				ss = parts[j]
-			} else {
-				ss += "," + parts[j]
-			}
-		}
-		if i == 0 {
-			ss = parts[i] + parts[i+1]
-		} else {
-			ss += "," + parts[i] + parts[i+1]
-		}
-		for k := i + 2; k < len(parts); k++ {
-			if k == 0 {
-				ss = parts[k]
-			} else {
-				ss += "," + parts[k]
-			}
-		}
-
-		cleaned := strings.ReplaceAll(ss, ",", "+")
-		cleaned = regexp.MustCompile(`\++`).ReplaceAllString(cleaned, "+")
-		proper := f.GetProperSegmentation(cleaned)
-		if !containsSlice(output, proper) {
-			output = append(output, proper)
-			if strings.Contains(ss, ",") {
-				output = f.getSubPartitions(ss, output)
-			}
+// withValidAffixes keeps the partitions whose prefixes and suffixes are listed
+// in hmValidPrefixes and hmValidSuffixes, or all of them if none is
+func (f *Farasa) withValidAffixes(partitions []string) []string {
+	var valid []string
+	for _, pp := range partitions {
+		parts := splitPartition(pp)
+		prefix := strings.ReplaceAll(strings.TrimSpace(parts[0]), "+", "")
+		suffix := strings.ReplaceAll(strings.TrimSpace(parts[2]), "+", "")
+		if f.hmValidPrefixes[prefix] && f.hmValidSuffixes[suffix] {
+			valid = append(valid, pp)
 		}
 	}
-	return output
+	if len(valid) == 0 {
+		return partitions
+	}
+	return valid
 }
 
-func containsSlice(slice []string, item string) bool {
-	for _, s := range slice {
-		if s == item {
-			return true
+// searchPartitions generates the partitions of word and of its لل/ولل/فلل
+// spelling with the article written out, reporting false when word is longer
+// than the search limits allow or needs more work
+func (f *Farasa) searchPartitions(word string) ([]string, bool) {
+	tokenizations, ok := f.PartitionsWithinLimits(word)
+	if !ok {
+		return nil, false
+	}
+	var alt string
+	if strings.HasPrefix(word, "\u0644\u0644") {
+		alt = "\u0644\u0627\u0644" + word[len("\u0644\u0644"):]
+	} else if strings.HasPrefix(word, "\u0648\u0644\u0644") {
+		alt = "\u0648\u0644\u0627\u0644" + word[len("\u0648\u0644\u0644"):]
+	} else if strings.HasPrefix(word, "\u0641\u0644\u0644") {
+		alt = "\u0641\u0644\u0627\u0644" + word[len("\u0641\u0644\u0644"):]
+	}
+	if alt != "" {
+		more, ok := f.partitions(alt, f.search.budget)
+		if !ok {
+			return nil, false
 		}
+		tokenizations = append(tokenizations, more...)
 	}
-	return false
+	return tokenizations, true
+}
+
+// splitPartition splits a prefix;stem;suffix partition into its three parts
+func splitPartition(pp string) []string {
+	return strings.Split(" "+pp+" ", ";")
 }
 
 // checkIfLeadingLettersCouldBePrefixes checks if head could be valid Arabic prefixes
 func checkIfLeadingLettersCouldBePrefixes(head string) bool {
-	matched, _ := regexp.MatchString(`^(\u0648|\u0641)?(\u0628|\u0643|\u0644)?(\u0627\u0644)?$`, head)
+	matched, _ := regexp.MatchString("^(\u0648|\u0641)?(\u0628|\u0643|\u0644)?(\u0627\u0644)?$", head)
 	return matched || head == "\u0633" || head == "\u0648\u0633" || head == "\u0641\u0633"
 }
 
@@ -618,37 +753,8 @@ func getPrefixSplit(head string) string {
 
 // GetProperSegmentation converts a raw partition into prefix;stem;suffix format
 func (f *Farasa) GetProperSegmentation(input string) string {
-	if len(f.hPrefixes) == 0 {
-		for _, p := range Prefixes {
-			f.hPrefixes[p] = 1
-		}
-	}
-	if len(f.hSuffixes) == 0 {
-		for _, s := range Suffixes {
-			f.hSuffixes[s] = 1
-		}
-	}
-
 	word := strings.Split(input, "+")
-	iValidPrefix := -1
-	for iValidPrefix+1 < len(word) {
-		if _, ok := f.hPrefixes[word[iValidPrefix+1]]; ok {
-			iValidPrefix++
-		} else {
-			break
-		}
-	}
-
-	iValidSuffix := len(word)
-	for iValidSuffix > max(iValidPrefix, 0) {
-		w := word[iValidSuffix-1]
-		_, isSuffix := f.hSuffixes[w]
-		if isSuffix || w == "_" {
-			iValidSuffix--
-		} else {
-			break
-		}
-	}
+	iValidPrefix, iValidSuffix := f.affixBounds(word)
 
 	currentPrefix := ""
 	for i := 0; i <= iValidPrefix; i++ {
@@ -660,12 +766,8 @@ func (f *Farasa) GetProperSegmentation(input string) string {
 		stemPart += word[i]
 	}
 
-	if iValidSuffix == iValidPrefix {
-		iValidSuffix++
-	}
-
 	currentSuffix := ""
-	for i := iValidSuffix; i < len(word) && iValidSuffix != iValidPrefix; i++ {
+	for i := iValidSuffix; i < len(word); i++ {
 		currentSuffix += "+" + word[i]
 	}
 
@@ -688,6 +790,36 @@ func (f *Farasa) GetProperSegmentation(input string) string {
 	return strings.ReplaceAll(output, "++", "+")
 }
 
+// affixBounds returns the index of the last leading piece that is a prefix and
+// the index of the first trailing piece that is a suffix. Pieces in between make
+// up the stem.
+func (f *Farasa) affixBounds(word []string) (int, int) {
+	iValidPrefix := -1
+	for iValidPrefix+1 < len(word) {
+		if _, ok := f.hPrefixes[word[iValidPrefix+1]]; ok {
+			iValidPrefix++
+		} else {
+			break
+		}
+	}
+
+	iValidSuffix := len(word)
+	for iValidSuffix > max(iValidPrefix, 0) {
+		w := word[iValidSuffix-1]
+		_, isSuffix := f.hSuffixes[w]
+		if isSuffix || w == "_" {
+			iValidSuffix--
+		} else {
+			break
+		}
+	}
+
+	if iValidSuffix == iValidPrefix {
+		iValidSuffix++
+	}
+	return iValidPrefix, iValidSuffix
+}
+
 func max(a, b int) int {
 	if a > b {
 		return a
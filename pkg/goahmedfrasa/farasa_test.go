@@ -0,0 +1,160 @@
+package goahmedfrasa
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+var (
+	defaultFarasaOnce sync.Once
+	defaultFarasa     *Farasa
+	defaultFarasaErr  error
+)
+
+// newTestFarasa loads the segmenter with opts from testDataDir. Without options
+// the instance is shared between tests.
+func newTestFarasa(tb testing.TB, opts ...Option) *Farasa {
+	tb.Helper()
+	if len(opts) == 0 {
+		defaultFarasaOnce.Do(func() {
+			defaultFarasa, defaultFarasaErr = NewFarasa(testDataDir)
+		})
+		if defaultFarasaErr != nil {
+			tb.Fatal(defaultFarasaErr)
+		}
+		return defaultFarasa
+	}
+	f, err := NewFarasa(testDataDir, opts...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return f
+}
+
+// BenchmarkSegment scores the words of the test corpora, with SeenBefore and
+// the segmentation cache disabled so that every word goes through the scorer,
+// with and without the template cache and with the valid affix filter
+func BenchmarkSegment(b *testing.B) {
+	benchmarks := []struct {
+		name string
+		opts []Option
+	}{
+		{"template-cache", nil},
+		{"no-template-cache", []Option{WithTemplateCacheSize(0)}},
+		{"valid-affixes", []Option{WithValidAffixes()}},
+	}
+	lines := testCorpus(b)
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			f := newTestFarasa(b, append([]Option{WithoutSeenBefore(), WithCacheSize(0)}, bm.opts...)...)
+			b.ResetTimer()
+			words := 0
+			for i := 0; i < b.N; i++ {
+				for _, line := range lines {
+					tokens, _ := f.SegmentWith(line, SegmentOptions{})
+					words += len(tokens)
+				}
+			}
+			b.ReportMetric(float64(words)/b.Elapsed().Seconds(), "words/s")
+		})
+	}
+}
+
+// TestValidAffixesSameBest checks that the candidates WithValidAffixes drops
+// never win: every word of the test corpora gets the same segmentation from
+// fewer candidates
+func TestValidAffixesSameBest(t *testing.T) {
+	base := []Option{WithoutSeenBefore(), WithoutPreviouslySeenTokenizations(), WithCacheSize(0)}
+	all := newTestFarasa(t, base...)
+	valid := newTestFarasa(t, append(base, WithValidAffixes())...)
+	fewer := 0
+	for _, line := range testCorpus(t) {
+		for _, word := range Tokenize(line) {
+			want, got := all.candidates(word), valid.candidates(word)
+			if len(got) > len(want) {
+				t.Errorf("%s: %d candidates with valid affixes, %d without", word, len(got), len(want))
+			}
+			if len(got) < len(want) {
+				fewer++
+			}
+			if b, a := best(valid, got), best(all, want); b != a {
+				t.Errorf("%s: best %s with valid affixes, %s without", word, b, a)
+			}
+		}
+	}
+	if fewer == 0 {
+		t.Error("valid affixes dropped no candidates")
+	}
+}
+
+// TestWordPossibleSplits loads a non-empty hmWordPossibleSplits with
+// WithValidAffixes. Words listed there take their candidates from it, without
+// the valid affix filter, and when it holds the lattice candidates of the test
+// corpora every word keeps its best segmentation.
+func TestWordPossibleSplits(t *testing.T) {
+	base := []Option{WithoutSeenBefore(), WithoutPreviouslySeenTokenizations(), WithCacheSize(0)}
+	all := newTestFarasa(t, base...)
+	filtered := newTestFarasa(t, append(base, WithValidAffixes())...)
+
+	splits := make(map[string][]string)
+	for _, line := range testCorpus(t) {
+		for _, word := range Tokenize(line) {
+			splits[word], _ = all.searchPartitions(word)
+		}
+	}
+	// والكتاب with two candidates only
+	listed := "والكتاب"
+	splits[listed] = []string{"و+ال+;كتاب;", "و+;الكتاب;"}
+
+	fsys := fstest.MapFS{}
+	entries, err := os.ReadDir(testDataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		data, err := os.ReadFile(testDataDir + e.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fsys[e.Name()] = &fstest.MapFile{Data: data}
+	}
+	data, err := json.Marshal(splits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys["hmWordPossibleSplits.json"] = &fstest.MapFile{Data: data}
+	valid, err := NewFarasaFS(fsys, append(base, WithValidAffixes())...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := valid.candidates(listed); len(got) != 2 || got[0] != splits[listed][0] || got[1] != splits[listed][1] {
+		t.Errorf("%s: candidates %v, want %v", listed, got, splits[listed])
+	}
+	if got := all.candidates(listed); len(got) <= 2 {
+		t.Errorf("%s: %d candidates without WithValidAffixes, want the lattice", listed, len(got))
+	}
+
+	unfiltered := 0
+	for _, line := range testCorpus(t) {
+		for _, word := range Tokenize(line) {
+			want, got := all.candidates(word), valid.candidates(word)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: candidates %v from the splits, want %v", word, got, want)
+			}
+			if len(filtered.candidates(word)) < len(got) {
+				unfiltered++
+			}
+			if b, a := best(valid, got), best(all, want); b != a {
+				t.Errorf("%s: best %s from the splits, %s from the lattice", word, b, a)
+			}
+		}
+	}
+	if unfiltered == 0 {
+		t.Error("the valid affix filter dropped no candidates of the splits, so they were not tested")
+	}
+}
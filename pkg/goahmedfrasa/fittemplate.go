@@ -2,7 +2,7 @@ package goahmedfrasa
 
 import (
 	"bufio"
-	"os"
+	"io/fs"
 	"strconv"
 	"strings"
 )
@@ -16,20 +16,26 @@ type FitTemplateClass struct {
 
 // NewFitTemplateClass creates and initializes a FitTemplateClass from data directory
 func NewFitTemplateClass(dataDir string) (*FitTemplateClass, error) {
+	return NewFitTemplateClassFS(dirFS(dataDir))
+}
+
+// NewFitTemplateClassFS creates and initializes a FitTemplateClass from roots.txt
+// and template-count.txt at the root of fsys
+func NewFitTemplateClassFS(fsys fs.FS) (*FitTemplateClass, error) {
 	ft := &FitTemplateClass{
 		hmRoot:    make(map[string]float64),
 		hmTemplate: make(map[string]float64),
 		templates:  make(map[int][]string),
 	}
-	if err := ft.initVariables(dataDir); err != nil {
+	if err := ft.initVariables(fsys); err != nil {
 		return nil, err
 	}
 	return ft, nil
 }
 
-func (ft *FitTemplateClass) initVariables(dataDir string) error {
+func (ft *FitTemplateClass) initVariables(fsys fs.FS) error {
 	// Load roots
-	rootFile, err := os.Open(dataDir + "roots.txt")
+	rootFile, err := fsys.Open("roots.txt")
 	if err != nil {
 		return err
 	}
@@ -48,7 +54,7 @@ func (ft *FitTemplateClass) initVariables(dataDir string) error {
 	}
 
 	// Load templates
-	templateFile, err := os.Open(dataDir + "template-count.txt")
+	templateFile, err := fsys.Open("template-count.txt")
 	if err != nil {
 		return err
 	}
@@ -74,79 +80,86 @@ func (ft *FitTemplateClass) initVariables(dataDir string) error {
 
 // FitTemplate tries to match a word to a known Arabic morphological template
 func (ft *FitTemplateClass) FitTemplate(line string) string {
-	tmp := ft.fitStemTemplate(UTF82Buck(line))
+	template, _ := ft.FitTemplateRoot(line)
+	return template
+}
+
+// FitTemplateRoot is FitTemplate also returning the root the template was
+// matched with, in the transliteration of roots.txt, or "" if none fits
+func (ft *FitTemplateClass) FitTemplateRoot(line string) (string, string) {
+	tmp, root := ft.fitStemTemplate(UTF82Buck(line))
 
 	// ends with ta marbouta or yeh
 	if strings.Contains(tmp, "Y") && (strings.HasSuffix(line, "\u0629") || strings.HasSuffix(line, "\u064a")) {
 		runes := []rune(line)
-		tmp = ft.fitStemTemplate(UTF82Buck(string(runes[:len(runes)-1])))
+		tmp, root = ft.fitStemTemplate(UTF82Buck(string(runes[:len(runes)-1])))
 	}
 	// ends with ya + ta marbouta
 	if strings.Contains(tmp, "Y") && strings.HasSuffix(line, "\u064a\u0629") {
 		runes := []rune(line)
-		tmp = ft.fitStemTemplate(UTF82Buck(string(runes[:len(runes)-2])))
+		tmp, root = ft.fitStemTemplate(UTF82Buck(string(runes[:len(runes)-2])))
 	}
 	// ends with alef maqsoura
 	if strings.Contains(tmp, "Y") && strings.HasSuffix(line, "\u0649") {
 		runes := []rune(line)
-		tmp = ft.fitStemTemplate(UTF82Buck(string(runes[:len(runes)-1]) + "\u064a"))
+		tmp, root = ft.fitStemTemplate(UTF82Buck(string(runes[:len(runes)-1]) + "\u064a"))
 	}
 	// contains any form of alef
 	if strings.Contains(tmp, "Y") && (strings.Contains(line, "\u0623") || strings.Contains(line, "\u0622") || strings.Contains(line, "\u0625")) {
 		normalized := strings.ReplaceAll(line, "\u0625", "\u0627")
 		normalized = strings.ReplaceAll(normalized, "\u0623", "\u0627")
 		normalized = strings.ReplaceAll(normalized, "\u0622", "\u0627")
-		tmp = ft.fitStemTemplate(UTF82Buck(normalized))
+		tmp, root = ft.fitStemTemplate(UTF82Buck(normalized))
 	}
 	// double last letter
 	if strings.Contains(tmp, "Y") && len([]rune(line)) > 1 {
 		runes := []rune(line)
-		tmp = ft.fitStemTemplate(UTF82Buck(line + string(runes[len(runes)-1])))
+		tmp, root = ft.fitStemTemplate(UTF82Buck(line + string(runes[len(runes)-1])))
 	}
 	// starts with "ات"
 	if strings.Contains(tmp, "Y") && strings.HasPrefix(line, "\u0627\u062a") {
 		runes := []rune(line)
-		tmp = ft.fitStemTemplate(UTF82Buck(string(runes[0:1]) + "\u0648" + string(runes[1:])))
+		tmp, root = ft.fitStemTemplate(UTF82Buck(string(runes[0:1]) + "\u0648" + string(runes[1:])))
 	}
 	// check for Ta/Dal at position 2
 	if strings.Contains(tmp, "Y") && len([]rune(line)) >= 5 {
 		runes := []rune(line)
 		ch := string(runes[2])
 		if ch == "\u0637" || ch == "\u062f" {
-			potential := ft.fitStemTemplate(UTF82Buck(string(runes[0:2]) + "\u062a" + string(runes[3:])))
+			potential, potentialRoot := ft.fitStemTemplate(UTF82Buck(string(runes[0:2]) + "\u062a" + string(runes[3:])))
 			if len([]rune(potential)) > 3 && string([]rune(potential)[2]) == "t" {
-				tmp = potential
+				tmp, root = potential, potentialRoot
 			}
 		}
 	}
 	// contains آ (alef madda)
 	if strings.Contains(tmp, "Y") && strings.Contains(line, "\u0622") {
-		tmp = ft.fitStemTemplate(UTF82Buck(strings.ReplaceAll(line, "\u0622", "\u0623\u0627")))
+		tmp, root = ft.fitStemTemplate(UTF82Buck(strings.ReplaceAll(line, "\u0622", "\u0623\u0627")))
 	}
 	// contains ئ or ؤ
 	if strings.Contains(tmp, "Y") && (strings.Contains(line, "\u0626") || strings.Contains(line, "\u0624")) {
 		replaced := strings.ReplaceAll(line, "\u0626", "\u0621")
 		replaced = strings.ReplaceAll(replaced, "\u0624", "\u0621")
-		tmp = ft.fitStemTemplate(UTF82Buck(replaced))
+		tmp, root = ft.fitStemTemplate(UTF82Buck(replaced))
 	}
-	return tmp
+	return tmp, root
 }
 
-func (ft *FitTemplateClass) fitStemTemplate(stem string) string {
+func (ft *FitTemplateClass) fitStemTemplate(stem string) (string, string) {
 	stemRunes := []rune(stem)
 	stemLen := len(stemRunes)
 
 	templates, exists := ft.templates[stemLen]
 	if !exists {
-		return "Y"
+		return "Y", ""
 	}
 
 	if stemLen == 2 {
 		root := Buck2Morph(stem + string(stemRunes[1]))
 		if _, ok := ft.hmRoot[root]; ok {
-			return "fE"
+			return "fE", root
 		}
-		return "Y"
+		return "Y", ""
 	}
 
 	var templateResults []string
@@ -227,7 +240,7 @@ func (ft *FitTemplateClass) fitStemTemplate(stem string) string {
 	}
 
 	if len(templateResults) == 0 {
-		return "Y"
+		return "Y", ""
 	}
 
 	var withC, withoutC []string
@@ -245,9 +258,10 @@ func (ft *FitTemplateClass) fitStemTemplate(stem string) string {
 	return ft.getBestTemplate(withoutC)
 }
 
-func (ft *FitTemplateClass) getBestTemplate(templates []string) string {
+func (ft *FitTemplateClass) getBestTemplate(templates []string) (string, string) {
 	bestScore := 0.0
 	bestTemplate := ""
+	bestRoot := ""
 	for _, s := range templates {
 		parts := strings.SplitN(s, "/", 2)
 		if len(parts) == 2 {
@@ -258,9 +272,10 @@ func (ft *FitTemplateClass) getBestTemplate(templates []string) string {
 				if bestScore < score {
 					bestScore = score
 					bestTemplate = parts[0]
+					bestRoot = parts[1]
 				}
 			}
 		}
 	}
-	return bestTemplate
+	return bestTemplate, bestRoot
 }
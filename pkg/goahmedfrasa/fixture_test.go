@@ -0,0 +1,324 @@
+package goahmedfrasa
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/data and the golden files")
+
+// testDataDir is the dictionary fixture the tests load, see TestFixture
+const testDataDir = "../../testdata/data/"
+
+// fixtureCopied are the files of data/ the fixture keeps whole, being small or
+// indexed by affixes rather than by words
+var fixtureCopied = []string{
+	"generalVariables.json", "hPrefixes.json", "hSuffixes.json", "hmStop.json", "hmTemplateCount.json",
+	"hmValidPrefixes.json", "hmValidSuffixes.json", "hmValidPrefixesSegmented.json", "hmValidSuffixesSegmented.json",
+	"hmWordPossibleSplits.json", "probCondPrefixes.json", "probCondSuffixes.json", "probPrefixSuffix.json",
+	"probPrefixes.json", "probSuffixPrefix.json", "probSuffixes.json", "template-count.txt",
+}
+
+// TestFixture checks that testdata/data holds the entries of data/ the words of
+// the testdata text files look up, so that they segment and score exactly as
+// with the full dictionaries, and rewrites it with -update.
+//
+// wordCount.json is not distributed with data/. The fixture has an estimate
+// instead, see estimateWordCount, with which the words of the README segment
+// like the Java version.
+func TestFixture(t *testing.T) {
+	if testing.Short() {
+		t.Skip("loads the full dictionaries")
+	}
+	full, err := fullDataFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := fixtureWords(t)
+	files, err := buildFixture(full, words)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixture := fstest.MapFS{}
+	for name, data := range files {
+		fixture[name] = &fstest.MapFile{Data: data}
+	}
+	for _, opts := range [][]Option{nil, {WithoutSeenBefore(), WithoutPreviouslySeenTokenizations()}} {
+		want, err := NewFarasaFS(full, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := NewFarasaFS(fixture, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range words {
+			if g, w2 := got.MostLikelyPartition(w, math.MaxInt), want.MostLikelyPartition(w, math.MaxInt); !reflect.DeepEqual(g, w2) {
+				t.Errorf("%s: fixture ranks %v, data/ %v", w, g, w2)
+			}
+			if g, w2 := got.segmentToken(w, SegmentOptions{}), want.segmentToken(w, SegmentOptions{}); !reflect.DeepEqual(g, w2) {
+				t.Errorf("%s: fixture segments %+v, data/ %+v", w, g, w2)
+			}
+		}
+	}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		file := filepath.Join(testDataDir, name)
+		if *update {
+			if err := os.WriteFile(file, files[name], 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if data, err := os.ReadFile(file); err != nil || !bytes.Equal(data, files[name]) {
+			t.Errorf("%s is out of date, run go test -run TestFixture -update", file)
+		}
+	}
+}
+
+// fullDataFS returns data/ along with the estimate of wordCount.json
+func fullDataFS() (fstest.MapFS, error) {
+	fsys := fstest.MapFS{}
+	paths, err := filepath.Glob("../../data/*.*")
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range paths {
+		if strings.HasSuffix(p, ".go") {
+			continue
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		fsys[filepath.Base(p)] = &fstest.MapFile{Data: data}
+	}
+	wordCount, err := estimateWordCount(fsys)
+	if err != nil {
+		return nil, err
+	}
+	data, err := fixtureJSON(wordCount)
+	if err != nil {
+		return nil, err
+	}
+	fsys["wordCount.json"] = &fstest.MapFile{Data: data}
+	return fsys, nil
+}
+
+// estimateWordCount stands in for the word frequencies of wordCount.json,
+// which are those of a large corpus. It counts the words of SeenBefore.json
+// whose stem, or stem followed by the first suffix, is the key, and stores the
+// log of its share of all the words.
+func estimateWordCount(fsys fs.FS) (map[string]float64, error) {
+	var seen map[string]string
+	if err := loadJSONFile(fsys, "SeenBefore.json", &seen); err != nil {
+		return nil, err
+	}
+	prefixes, err := loadJSONIntMap(fsys, "hPrefixes.json")
+	if err != nil {
+		return nil, err
+	}
+	suffixes, err := loadJSONIntMap(fsys, "hSuffixes.json")
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]float64)
+	for _, seg := range seen {
+		pieces := strings.Split(seg, "+")
+		i, j := 0, len(pieces)
+		for i < j-1 && prefixes.has(pieces[i]) {
+			i++
+		}
+		for j > i+1 && suffixes.has(pieces[j-1]) {
+			j--
+		}
+		stem := strings.Join(pieces[i:j], "")
+		counts[stem]++
+		if j < len(pieces) {
+			counts[stem+pieces[j]]++
+		}
+	}
+	for k, c := range counts {
+		counts[k] = math.Log(c / float64(len(seen)))
+	}
+	return counts, nil
+}
+
+// fixtureWords returns the words of the text files of testdata, as written and
+// with the clitics of gold corpora glued back
+func fixtureWords(tb testing.TB) []string {
+	tb.Helper()
+	paths, err := filepath.Glob("../../testdata/*.txt")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	set := make(map[string]bool)
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		for _, w := range Tokenize(strings.ReplaceAll(string(data), "+", "")) {
+			set[w] = true
+		}
+		golds, err := readGoldWords(bytes.NewReader(data))
+		if err != nil {
+			tb.Fatal(err)
+		}
+		for _, g := range golds {
+			set[strings.ReplaceAll(g, "+", "")] = true
+		}
+	}
+	var words []string
+	for w := range set {
+		words = append(words, w)
+		if b := Buck2UTF8(w); b != w {
+			words = append(words, b)
+		}
+	}
+	sort.Strings(words)
+	return words
+}
+
+// buildFixture returns the files of the fixture of full for words
+func buildFixture(full fstest.MapFS, words []string) (map[string][]byte, error) {
+	f, err := NewFarasaFS(full, WithCacheSize(0), WithTemplateCacheSize(0))
+	if err != nil {
+		return nil, err
+	}
+	sets := map[string]*recordedSet{}
+	for name, table := range map[string]*setTable{
+		"hmListMorph": &f.hmListMorph, "hmListGaz": &f.hmListGaz, "hmAraLexCom": &f.hmAraLexCom,
+		"hmBuck": &f.hmBuck, "hmLocations": &f.hmLocations, "hmPeople": &f.hmPeople,
+	} {
+		sets[name] = &recordedSet{table: (*table).(intMap), found: intMap{}}
+		*table = sets[name]
+	}
+	wordCount := &recordedFloats{table: f.wordCount.(floatMap), found: floatMap{}}
+	f.wordCount = wordCount
+	seenBefore := f.hmSeenBefore.(stringMap)
+	tokenizations := f.hmPreviouslySeenTokenizations.(listMap)
+
+	files := map[string]any{}
+	foundSeen, foundTokenizations := stringMap{}, listMap{}
+	for _, w := range words {
+		if seg, ok := seenBefore[w]; ok {
+			foundSeen[w] = seg
+		}
+		if ts, ok := tokenizations[w]; ok {
+			foundTokenizations[w] = ts
+		}
+		f.MostLikelyPartition(w, math.MaxInt)
+	}
+	// and the candidates the known tokenizations replace
+	f.hmPreviouslySeenTokenizations = listMap{}
+	for _, w := range words {
+		f.MostLikelyPartition(w, math.MaxInt)
+	}
+	files["SeenBefore.json"] = foundSeen
+	files["hmPreviouslySeenTokenizations.json"] = foundTokenizations
+	files["wordCount.json"] = wordCount.found
+	for name, set := range sets {
+		files[name+".json"] = set.found
+	}
+	// nothing reads it
+	files["seenTemplates.json"] = map[string]float64{}
+
+	out := make(map[string][]byte)
+	for name, v := range files {
+		if out[name], err = fixtureJSON(v); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range fixtureCopied {
+		out[name] = full[name].Data
+	}
+
+	// roots.txt keeps the roots the scored stems match with every template on
+	// its own. A missing root would not only lose its match but also have the
+	// template try its variants with w, y and A.
+	roots := make(map[string]bool)
+	for n, templates := range f.ft.templates {
+		for _, tmpl := range templates {
+			single := &FitTemplateClass{hmRoot: f.ft.hmRoot, hmTemplate: f.ft.hmTemplate, templates: map[int][]string{n: {tmpl}}}
+			for stem := range wordCount.asked {
+				if _, root := single.FitTemplateRoot(stem); root != "" {
+					roots[root] = true
+				}
+			}
+		}
+	}
+	var kept bytes.Buffer
+	sc := bufio.NewScanner(bytes.NewReader(full["roots.txt"].Data))
+	for sc.Scan() {
+		if root, _, _ := strings.Cut(sc.Text(), "\t"); roots[root] {
+			kept.WriteString(sc.Text() + "\n")
+		}
+	}
+	out["roots.txt"] = kept.Bytes()
+	return out, nil
+}
+
+// fixtureJSON encodes v with one entry per line, so that the fixture diffs
+// well
+func fixtureJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", " ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// recordedSet is a setTable remembering the keys it has
+type recordedSet struct {
+	table intMap
+	found intMap
+}
+
+func (s *recordedSet) has(key string) bool {
+	v, ok := s.table[key]
+	if ok {
+		s.found[key] = v
+	}
+	return ok
+}
+
+// recordedFloats is a floatTable remembering the keys it was asked for and
+// those it has
+type recordedFloats struct {
+	table floatMap
+	found floatMap
+	asked map[string]bool
+}
+
+func (t *recordedFloats) get(key string) (float64, bool) {
+	if t.asked == nil {
+		t.asked = make(map[string]bool)
+	}
+	t.asked[key] = true
+	v, ok := t.table[key]
+	if ok {
+		t.found[key] = v
+	}
+	return v, ok
+}
@@ -0,0 +1,266 @@
+package goahmedfrasa
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Candidate generation
+//
+// Every candidate is the GetProperSegmentation of some split of the word into
+// pieces: the longest run of leading pieces found in hPrefixes becomes the
+// prefix, the longest run of trailing pieces found in hSuffixes the suffix and
+// the pieces in between are glued into the stem. Splits that differ only in how
+// the stem is cut give the same candidate, so instead of trying all 2^(n-1)
+// splits of an n letter word it is enough to pair every chain of prefixes at the
+// start of the word with every chain of suffixes at its end, and to cut the
+// letters in between into at most three stem pieces such that the first is no
+// prefix and the last no suffix. Those chains form a small lattice over the
+// letters of the word, which keeps the work roughly linear for real words.
+//
+// Runs of letters that are affixes by themselves, such as a repeated suffix, do
+// make the number of chains grow exponentially. MostLikelyPartition therefore
+// gives up on words that are too long or need too many chains and falls back to
+// a split that does not search at all.
+
+// Fallback tells MostLikelyPartition what to do with a word it gives up on
+type Fallback int
+
+const (
+	// FallbackAffixes splits off the leading prefixes and one suffix by rule
+	// and keeps the rest as the stem
+	FallbackAffixes Fallback = iota
+	// FallbackUnchanged keeps the whole word as the stem
+	FallbackUnchanged
+)
+
+// searchLimits bounds the candidate search of a single word
+type searchLimits struct {
+	// maxWordLength is the longest word in letters that is searched, 0 for
+	// any. It counts the affixes too, as they are what the work grows with.
+	maxWordLength int
+	// budget bounds the prefix chains, the suffix chains and the pairs of
+	// them, 0 for no bound
+	budget   int
+	fallback Fallback
+}
+
+// defaultSearchLimits is far above what real words need: none of the words in
+// the training data is longer than 24 letters or has more than a hundred
+// candidates
+var defaultSearchLimits = searchLimits{maxWordLength: 40, budget: 4096}
+
+// affixChain is a run of affixes covering the letters of a word up to (for
+// prefixes) or from (for suffixes) the rune offset pos
+type affixChain struct {
+	pos    int
+	pieces []string
+}
+
+// GetAllPossiblePartitionsOfString generates all possible partitions of a
+// string in prefix;stem;suffix form, in no particular order. Unlike
+// MostLikelyPartition it ignores the search limits, so the number of
+// partitions can grow exponentially with the length of the string.
+func (f *Farasa) GetAllPossiblePartitionsOfString(s string) []string {
+	output, _ := f.partitions(s, 0)
+	return output
+}
+
+// PartitionsWithinLimits is GetAllPossiblePartitionsOfString within the
+// search limits of MostLikelyPartition, see WithMaxSearchWordLength and
+// WithSearchBudget. It reports false, with no partitions, for a word beyond
+// them, which MostLikelyPartition gives the fallback partition instead.
+func (f *Farasa) PartitionsWithinLimits(s string) ([]string, bool) {
+	if f.search.maxWordLength > 0 && utf8.RuneCountInString(strings.TrimSpace(s)) > f.search.maxWordLength {
+		return nil, false
+	}
+	return f.partitions(s, f.search.budget)
+}
+
+// partitions is GetAllPossiblePartitionsOfString giving up when the prefix
+// chains, the suffix chains or their pairs outnumber budget, unless budget is
+// 0. It reports whether it finished.
+func (f *Farasa) partitions(s string, budget int) ([]string, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return nil, true
+	}
+	runes := []rune(s)
+	n := len(runes)
+	prefixChains, ok := f.affixChains(runes, true, budget)
+	if !ok {
+		return nil, false
+	}
+	suffixChains, ok := f.affixChains(runes, false, budget)
+	if !ok || budget > 0 && len(prefixChains)*len(suffixChains) > budget {
+		return nil, false
+	}
+
+	// The Java version leaves out the split into single letters when its stem is
+	// a single byte, unless another split gives the same candidate.
+	fullSplit := make([]string, n)
+	for i, r := range runes {
+		fullSplit[i] = string(r)
+	}
+	fullCandidate := f.GetProperSegmentation(strings.Join(fullSplit, "+"))
+	keepFull := n == 1 || len(splitPartition(fullCandidate)[1]) != 1
+
+	var output []string
+	seen := make(map[string]bool)
+	emit := func(pieces []string) {
+		pp := f.GetProperSegmentation(strings.Join(pieces, "+"))
+		if pp == fullCandidate && !keepFull && len(pieces) == n {
+			return
+		}
+		if !seen[pp] {
+			seen[pp] = true
+			output = append(output, pp)
+		}
+	}
+
+	pieces := make([]string, 0, n)
+	for _, pc := range prefixChains {
+		for _, sc := range suffixChains {
+			if pc.pos > sc.pos {
+				continue
+			}
+			pieces = append(pieces[:0], pc.pieces...)
+			stem := runes[pc.pos:sc.pos]
+			if len(stem) == 0 {
+				emit(append(pieces, sc.pieces...))
+				continue
+			}
+			emit(append(append(pieces, string(stem)), sc.pieces...))
+			if w := f.stemWitness(stem); w != nil {
+				pieces = append(pieces[:0], pc.pieces...)
+				emit(append(append(pieces, w...), sc.pieces...))
+			}
+		}
+	}
+	return output, true
+}
+
+// affixChains returns every run of prefixes starting at the beginning of the
+// word, or with prefixes unset every run of suffixes ending at its end,
+// including the empty run. It gives up when there are more than budget runs,
+// unless budget is 0.
+func (f *Farasa) affixChains(runes []rune, prefixes bool, budget int) ([]affixChain, bool) {
+	table, maxLen := f.hSuffixes, f.maxSuffixLen
+	start := len(runes)
+	if prefixes {
+		table, maxLen = f.hPrefixes, f.maxPrefixLen
+		start = 0
+	}
+
+	var chains []affixChain
+	var walk func(pos int, pieces []string)
+	walk = func(pos int, pieces []string) {
+		if budget > 0 && len(chains) > budget {
+			return
+		}
+		chains = append(chains, affixChain{pos, pieces})
+		for l := 1; l <= maxLen; l++ {
+			var piece string
+			if prefixes {
+				if pos+l > len(runes) {
+					break
+				}
+				piece = string(runes[pos : pos+l])
+			} else {
+				if pos-l < 0 {
+					break
+				}
+				piece = string(runes[pos-l : pos])
+			}
+			if _, ok := table[piece]; !ok && (prefixes || piece != "_") {
+				continue
+			}
+			next := make([]string, 0, len(pieces)+1)
+			if prefixes {
+				walk(pos+l, append(append(next, pieces...), piece))
+			} else {
+				walk(pos-l, append(append(next, piece), pieces...))
+			}
+		}
+	}
+	walk(start, nil)
+	return chains, budget == 0 || len(chains) <= budget
+}
+
+// stemWitness cuts a stem into pieces whose first is no prefix and whose last
+// is no suffix, so that GetProperSegmentation keeps them all in the stem even
+// when the stem as a whole is an affix. It returns nil when no such cut exists
+// or when the stem needs no cutting.
+func (f *Farasa) stemWitness(stem []rune) []string {
+	whole := string(stem)
+	_, isPrefix := f.hPrefixes[whole]
+	_, isSuffix := f.hSuffixes[whole]
+	if !isPrefix && !isSuffix && whole != "_" {
+		return nil
+	}
+
+	// shortest leading piece that is no prefix
+	i := 1
+	for ; i <= len(stem); i++ {
+		if _, ok := f.hPrefixes[string(stem[:i])]; !ok {
+			break
+		}
+	}
+	// shortest trailing piece that is no suffix
+	j := len(stem) - 1
+	for ; j >= 0; j-- {
+		piece := string(stem[j:])
+		if _, ok := f.hSuffixes[piece]; !ok && piece != "_" {
+			break
+		}
+	}
+	if i > j {
+		return nil
+	}
+	w := []string{string(stem[:i])}
+	if i < j {
+		w = append(w, string(stem[i:j]))
+	}
+	return append(w, string(stem[j:]))
+}
+
+// fallbackPartition is the partition MostLikelyPartition settles for when it
+// gives up on word: with FallbackAffixes the longest head made of the usual
+// proclitics and the longest known suffix leaving a stem of at least two
+// letters are split off, with FallbackUnchanged the word is all stem
+func (f *Farasa) fallbackPartition(word string) string {
+	if f.search.fallback == FallbackUnchanged {
+		return ";" + word + ";"
+	}
+	runes := []rune(word)
+	var pieces []string
+	start := 0
+	for i := min(len(runes)-2, 4); i > 0; i-- {
+		if head := string(runes[:i]); checkIfLeadingLettersCouldBePrefixes(head) {
+			pieces = strings.Split(getPrefixSplit(head), ",")
+			start = i
+			break
+		}
+	}
+	end := len(runes)
+	for l := min(end-start-2, f.maxSuffixLen); l > 0; l-- {
+		if _, ok := f.hSuffixes[string(runes[end-l:])]; ok {
+			end -= l
+			break
+		}
+	}
+	pieces = append(pieces, string(runes[start:end]))
+	if end < len(runes) {
+		pieces = append(pieces, string(runes[end:]))
+	}
+	return f.GetProperSegmentation(strings.Join(pieces, "+"))
+}
+
+// maxKeyLength returns the length in runes of the longest key of table
+func maxKeyLength(table map[string]int) int {
+	n := 0
+	for k := range table {
+		n = max(n, utf8.RuneCountInString(k))
+	}
+	return n
+}
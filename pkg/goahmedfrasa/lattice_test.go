@@ -0,0 +1,147 @@
+package goahmedfrasa
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+// exhaustivePartitions is the definition the lattice implements: the
+// GetProperSegmentation of every one of the 2^(n-1) splits of an n letter
+// word, without the full split into single letters when its stem is a single
+// byte, as in the Java version
+func exhaustivePartitions(f *Farasa, word string) []string {
+	runes := []rune(word)
+	n := len(runes)
+	full := make([]string, n)
+	for i, r := range runes {
+		full[i] = string(r)
+	}
+	fullCandidate := f.GetProperSegmentation(strings.Join(full, "+"))
+	keepFull := n == 1 || len(splitPartition(fullCandidate)[1]) != 1
+
+	seen := make(map[string]bool)
+	var out []string
+	for mask := 0; mask < 1<<(n-1); mask++ {
+		var pieces []string
+		start := 0
+		for i := 1; i <= n; i++ {
+			if i == n || mask&(1<<(i-1)) != 0 {
+				pieces = append(pieces, string(runes[start:i]))
+				start = i
+			}
+		}
+		pp := f.GetProperSegmentation(strings.Join(pieces, "+"))
+		if pp == fullCandidate && !keepFull && len(pieces) == n {
+			continue
+		}
+		if !seen[pp] {
+			seen[pp] = true
+			out = append(out, pp)
+		}
+	}
+	return out
+}
+
+// best returns the partition MostLikelyPartition would pick among partitions
+func best(f *Farasa, partitions []string) string {
+	var top ScoredPartition
+	for i, pp := range partitions {
+		sp := ScoredPartition{f.ScorePartition(splitPartition(pp)), pp}
+		if i == 0 || sp.better(top) {
+			top = sp
+		}
+	}
+	return top.partition
+}
+
+// latticeDifferences lists the words of the test whose search candidates are
+// not those of GetAllPossiblePartitionsOfString, and why
+var latticeDifferences = map[string]string{
+	// searchPartitions adds the candidates of the word spelled with the
+	// determiner, ل+ال, which win here
+	"\u0644\u0644\u062a\u0648\u0627\u0635\u0644": "extra candidates of \u0644\u0627\u0644\u062a\u0648\u0627\u0635\u0644",
+	"\u0648\u0644\u0644\u0643\u062a\u0627\u0628": "extra candidates of \u0648\u0644\u0627\u0644\u0643\u062a\u0627\u0628",
+	"\u0641\u0644\u0644":                         "extra candidates of \u0641\u0644\u0627\u0644",
+}
+
+// sortedSet returns the distinct partitions in order
+func sortedSet(partitions []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, p := range partitions {
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestLatticeMatchesExhaustive(t *testing.T) {
+	f := newTestFarasa(t)
+	words := []string{
+		// the one difference with the recursive generator
+		"\u0627\u0644\u062a\u0627\u064a\u0648\u0627\u0646\u064a\u0648\u0646",
+		"\u0648\u0644\u0644\u0643\u062a\u0627\u0628",
+		// a comma inside a word is a letter to the lattice, although affix
+		// lookups ignore commas
+		"\u0648,\u0627\u0644", "\u0628,\u0627\u0644,\u0643\u062a\u0627\u0628",
+	}
+	for _, line := range testLines(t, "partitions.txt") {
+		words = append(words, Tokenize(RemoveDiacritics(line))...)
+	}
+	for _, word := range words {
+		all := sortedSet(f.GetAllPossiblePartitionsOfString(word))
+		exhaustive := sortedSet(exhaustivePartitions(f, word))
+		if strings.Join(all, " ") != strings.Join(exhaustive, " ") {
+			t.Errorf("%s: lattice %v, exhaustive %v", word, all, exhaustive)
+			continue
+		}
+		search, ok := f.searchPartitions(word)
+		if !ok {
+			t.Errorf("%s: search gave up", word)
+			continue
+		}
+		search = sortedSet(search)
+		same := strings.Join(search, " ") == strings.Join(all, " ")
+		if reason, known := latticeDifferences[word]; known {
+			if same {
+				t.Errorf("%s: listed as different (%s) but the candidates are the same", word, reason)
+			} else if len(search) <= len(all) {
+				t.Errorf("%s: %d search candidates, want more than the %d exhaustive ones", word, len(search), len(all))
+			}
+			continue
+		}
+		if !same {
+			t.Errorf("%s: search candidates %v, exhaustive %v", word, search, all)
+		}
+		if got, want := best(f, search), best(f, all); got != want {
+			t.Errorf("%s: top candidate %s, exhaustive %s", word, got, want)
+		}
+	}
+}
+
+// TestMaxSearchWordLength checks that the limit counts the letters of the
+// whole word, affixes included
+func TestMaxSearchWordLength(t *testing.T) {
+	if _, err := NewFarasa(testDataDir, WithMaxSearchWordLength(-1)); err == nil {
+		t.Error("negative length accepted")
+	}
+	// a four letter stem in a nine letter word
+	word := "والكتابين"
+	for _, tt := range []struct {
+		max      int
+		searched bool
+	}{{5, false}, {8, false}, {9, true}, {0, true}} {
+		f := newTestFarasa(t, WithMaxSearchWordLength(tt.max))
+		_, searched := f.searchPartitions(word)
+		if searched != tt.searched {
+			t.Errorf("WithMaxSearchWordLength(%d): searched %v, want %v", tt.max, searched, tt.searched)
+		}
+		if _, ok := f.PartitionsWithinLimits(word); ok != tt.searched {
+			t.Errorf("WithMaxSearchWordLength(%d): PartitionsWithinLimits reports %v, want %v", tt.max, ok, tt.searched)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package goahmedfrasa
+
+// The dictionaries consulted while scoring are read through these small
+// interfaces so that they can be backed either by Go maps or by tables inside a
+// memory-mapped model file. Both give the same answers for the same data.
+
+// setTable answers membership queries
+type setTable interface {
+	has(key string) bool
+}
+
+// floatTable maps words to numbers such as counts and probabilities
+type floatTable interface {
+	get(key string) (float64, bool)
+}
+
+// stringTable maps words to a single string, such as a cached segmentation
+type stringTable interface {
+	get(key string) (string, bool)
+}
+
+// listTable maps words to a list of strings
+type listTable interface {
+	get(key string) ([]string, bool)
+}
+
+// pairTable maps pairs of words to numbers, such as prefix-suffix co-occurrence
+type pairTable interface {
+	get(outer, inner string) (float64, bool)
+}
+
+type intMap map[string]int
+
+func (m intMap) has(key string) bool {
+	_, ok := m[key]
+	return ok
+}
+
+type floatMap map[string]float64
+
+func (m floatMap) get(key string) (float64, bool) {
+	v, ok := m[key]
+	return v, ok
+}
+
+type stringMap map[string]string
+
+func (m stringMap) get(key string) (string, bool) {
+	v, ok := m[key]
+	return v, ok
+}
+
+type listMap map[string][]string
+
+func (m listMap) get(key string) ([]string, bool) {
+	v, ok := m[key]
+	return v, ok
+}
+
+type nestedMap map[string]map[string]float64
+
+func (m nestedMap) get(outer, inner string) (float64, bool) {
+	v, ok := m[outer][inner]
+	return v, ok
+}
@@ -0,0 +1,189 @@
+package goahmedfrasa
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"unsafe"
+)
+
+// mappedTable is a sorted section of a model file read in place. Lookups are a
+// binary search over the keys and never copy the file contents, so processes
+// mapping the same model share its pages.
+type mappedTable struct {
+	n            int
+	keyOffsets   []byte
+	keys         []byte
+	values       []byte
+	valueOffsets []byte
+}
+
+// newMappedTable checks the bounds of a section once so that lookups do not
+// have to
+func newMappedTable(ref sectionRef) (*mappedTable, error) {
+	t := &mappedTable{}
+	data := ref.data
+	bad := fmt.Errorf("%w: corrupt section", ErrBadModel)
+	if len(data) < 4 {
+		return t, bad
+	}
+	n := int(binary.LittleEndian.Uint32(data))
+	p := 4
+	if (len(data)-p)/4 < n+1 {
+		return t, bad
+	}
+	t.n = n
+	t.keyOffsets = data[p : p+4*(n+1)]
+	p += 4 * (n + 1)
+	keysLen := int(binary.LittleEndian.Uint32(t.keyOffsets[4*n:]))
+	if keysLen > len(data)-p || !offsetsValid(t.keyOffsets, n, keysLen) {
+		return t, bad
+	}
+	t.keys = data[p : p+keysLen]
+	p += keysLen
+
+	switch ref.kind {
+	case kindFloat:
+		if len(data)-p < 8*n {
+			return t, bad
+		}
+		t.values = data[p : p+8*n]
+	case kindString, kindList:
+		if (len(data)-p)/4 < n+1 {
+			return t, bad
+		}
+		t.valueOffsets = data[p : p+4*(n+1)]
+		t.values = data[p+4*(n+1):]
+		if !offsetsValid(t.valueOffsets, n, len(t.values)) {
+			return t, bad
+		}
+	default:
+		return t, fmt.Errorf("%w: section kind %d cannot be mapped", ErrBadModel, ref.kind)
+	}
+	return t, nil
+}
+
+func offsetsValid(offsets []byte, n, limit int) bool {
+	prev := uint32(0)
+	for i := 0; i <= n; i++ {
+		off := binary.LittleEndian.Uint32(offsets[4*i:])
+		if off < prev || int(off) > limit {
+			return false
+		}
+		prev = off
+	}
+	return true
+}
+
+// bytesString views b as a string without copying it. The view is only valid
+// while the file is mapped, so values handed out by the tables are copied.
+func bytesString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return unsafe.String(&b[0], len(b))
+}
+
+func (t *mappedTable) key(i int) string {
+	start := binary.LittleEndian.Uint32(t.keyOffsets[4*i:])
+	end := binary.LittleEndian.Uint32(t.keyOffsets[4*i+4:])
+	return bytesString(t.keys[start:end])
+}
+
+func (t *mappedTable) find(key string) (int, bool) {
+	lo, hi := 0, t.n
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if t.key(mid) < key {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, lo < t.n && t.key(lo) == key
+}
+
+func (t *mappedTable) has(key string) bool {
+	_, ok := t.find(key)
+	return ok
+}
+
+func (t *mappedTable) value(i int) string {
+	start := binary.LittleEndian.Uint32(t.valueOffsets[4*i:])
+	end := binary.LittleEndian.Uint32(t.valueOffsets[4*i+4:])
+	return bytesString(t.values[start:end])
+}
+
+type mappedFloats struct{ *mappedTable }
+
+func (t mappedFloats) get(key string) (float64, bool) {
+	i, ok := t.find(key)
+	if !ok {
+		return 0, false
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(t.values[8*i:])), true
+}
+
+type mappedStrings struct{ *mappedTable }
+
+func (t mappedStrings) get(key string) (string, bool) {
+	i, ok := t.find(key)
+	if !ok {
+		return "", false
+	}
+	// the value outlives the mapping once it leaves the package
+	return strings.Clone(t.value(i)), true
+}
+
+type mappedLists struct{ *mappedTable }
+
+func (t mappedLists) get(key string) ([]string, bool) {
+	i, ok := t.find(key)
+	if !ok {
+		return nil, false
+	}
+	return decodeList(strings.Clone(t.value(i)))
+}
+
+type mappedPairs struct{ *mappedTable }
+
+func (t mappedPairs) get(outer, inner string) (float64, bool) {
+	return mappedFloats(t).get(outer + "\x00" + inner)
+}
+
+// NewFarasaMmap creates a Farasa instance backed by a memory-mapped binary model
+// file written by ConvertData. The large dictionaries are looked up in place
+// rather than copied into maps, so processes on one host share a single copy
+// of them in the page cache. Close releases the mapping.
+func NewFarasaMmap(modelPath string, opts ...Option) (*Farasa, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	data, unmap, err := mapFile(modelPath)
+	if err != nil {
+		return nil, fmt.Errorf("mapping model file: %w", err)
+	}
+	m, ft, err := buildModel(data, true, cfg.skip)
+	if err != nil {
+		unmap()
+		return nil, fmt.Errorf("loading model file: %w", err)
+	}
+	f := newFarasa(m, ft, cfg)
+	f.unmap = unmap
+	return f, nil
+}
+
+// Close releases the memory mapping of an instance created by NewFarasaMmap.
+// The instance must not be used afterwards, but results it returned before,
+// such as tokens and SeenBefore segmentations, stay valid. It is a no-op for
+// other instances.
+func (f *Farasa) Close() error {
+	if f.unmap == nil {
+		return nil
+	}
+	err := f.unmap()
+	f.unmap = nil
+	return err
+}
@@ -0,0 +1,79 @@
+package goahmedfrasa
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestMmapResultsOutliveClose reads results of a memory-mapped instance after
+// Close has unmapped the model file. Strings still pointing into the mapping
+// would fault or have changed here.
+func TestMmapResultsOutliveClose(t *testing.T) {
+	want := newTestFarasa(t)
+	path := filepath.Join(t.TempDir(), "goahmedfrasa.model")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ConvertData(testDataDir, out); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFarasaMmap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type seen struct{ word, seg string }
+	var seenBefore []seen
+	var tokens []Token
+	var nbest []Candidate
+	for _, line := range testCorpus(t) {
+		toks, _ := f.SegmentWith(line, SegmentOptions{NoNormalize: true})
+		tokens = append(tokens, toks...)
+		for _, tok := range toks {
+			if seg, ok := f.SeenBefore(tok.Text); ok {
+				seenBefore = append(seenBefore, seen{tok.Text, seg})
+			}
+			nbest = append(nbest, f.NBest(tok.Text, 2, SegmentOptions{NoNormalize: true})...)
+		}
+	}
+	if len(seenBefore) == 0 {
+		t.Fatal("no word of the test corpus is in SeenBefore")
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	runtime.GC()
+
+	// SeenBefore also answers from the run time cache, so the reference
+	// segments the corpus too
+	for _, line := range testCorpus(t) {
+		want.SegmentWith(line, SegmentOptions{})
+	}
+	for _, s := range seenBefore {
+		if seg, _ := want.SeenBefore(s.word); s.seg != seg {
+			t.Errorf("SeenBefore(%s) after Close = %q, want %q", s.word, s.seg, seg)
+		}
+	}
+	for _, tok := range tokens {
+		w, _ := want.SegmentWith(tok.Text, SegmentOptions{NoNormalize: true})
+		if len(w) != 1 || tok.Segmented != w[0].Segmented {
+			t.Errorf("token %s after Close = %q, want %v", tok.Text, tok.Segmented, w)
+		}
+		for _, m := range tok.Morphemes {
+			if m.Text == "" {
+				t.Errorf("token %s after Close has an empty morpheme", tok.Text)
+			}
+		}
+	}
+	for _, c := range nbest {
+		if c.Segmented == "" || c.Partition == "" {
+			t.Errorf("n-best candidate after Close = %+v", c)
+		}
+	}
+}
@@ -0,0 +1,642 @@
+package goahmedfrasa
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Binary model layout, all integers little endian:
+//
+//	magic "GOFARASA" | version u32 | section count u32
+//	directory: per section name length u16, name, kind u8, offset u64, length u64
+//	sections
+//	CRC-32 (IEEE) of everything above, u32
+//
+// Every section is a table sorted by key:
+//
+//	count u32 | key offsets (count+1)*u32 | keys
+//	values: float64 per key, a byte per key for booleans, or value offsets
+//	(count+1)*u32 followed by the values for strings and lists. A list value
+//	is a sequence of uvarint length prefixed strings.
+const (
+	modelMagic   = "GOFARASA"
+	modelVersion = 1
+)
+
+const (
+	kindFloat byte = iota + 1
+	kindBool
+	kindString
+	kindList
+)
+
+// ErrBadModel is returned when a binary model file is truncated, corrupted or
+// of an unsupported version
+var ErrBadModel = errors.New("invalid binary model")
+
+// table is the decoded form of a section. Only the slice matching the section
+// kind is set.
+type table struct {
+	keys    []string
+	floats  []float64
+	bools   []bool
+	strings []string
+	lists   [][]string
+}
+
+type section struct {
+	name string
+	kind byte
+	tbl  table
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// The section builders are only used on dictionaries loaded from JSON, which
+// are always backed by maps.
+
+func intSection(name string, t setTable) section {
+	m, _ := t.(intMap)
+	s := section{name: name, kind: kindFloat}
+	s.tbl.keys = sortedKeys(m)
+	for _, k := range s.tbl.keys {
+		s.tbl.floats = append(s.tbl.floats, float64(m[k]))
+	}
+	return s
+}
+
+func floatSection(name string, m map[string]float64) section {
+	s := section{name: name, kind: kindFloat}
+	s.tbl.keys = sortedKeys(m)
+	for _, k := range s.tbl.keys {
+		s.tbl.floats = append(s.tbl.floats, m[k])
+	}
+	return s
+}
+
+func boolSection(name string, m map[string]bool) section {
+	s := section{name: name, kind: kindBool}
+	s.tbl.keys = sortedKeys(m)
+	for _, k := range s.tbl.keys {
+		s.tbl.bools = append(s.tbl.bools, m[k])
+	}
+	return s
+}
+
+func stringSection(name string, t stringTable) section {
+	m, _ := t.(stringMap)
+	s := section{name: name, kind: kindString}
+	s.tbl.keys = sortedKeys(m)
+	for _, k := range s.tbl.keys {
+		s.tbl.strings = append(s.tbl.strings, m[k])
+	}
+	return s
+}
+
+func listSection(name string, m map[string][]string) section {
+	s := section{name: name, kind: kindList}
+	s.tbl.keys = sortedKeys(m)
+	for _, k := range s.tbl.keys {
+		s.tbl.lists = append(s.tbl.lists, m[k])
+	}
+	return s
+}
+
+// nestedSection flattens a two level map into keys of the form outer NUL inner
+func nestedSection(name string, t pairTable) section {
+	m, _ := t.(nestedMap)
+	flat := make(map[string]float64)
+	for outer, inner := range m {
+		for k, v := range inner {
+			flat[outer+"\x00"+k] = v
+		}
+	}
+	return floatSection(name, flat)
+}
+
+func asFloatMap(t floatTable) floatMap {
+	m, _ := t.(floatMap)
+	return m
+}
+
+func asListMap(t listTable) listMap {
+	m, _ := t.(listMap)
+	return m
+}
+
+func (t table) intMap() intMap {
+	m := make(intMap, len(t.keys))
+	for i, k := range t.keys {
+		m[k] = int(t.floats[i])
+	}
+	return m
+}
+
+func (t table) floatMap() floatMap {
+	m := make(floatMap, len(t.keys))
+	for i, k := range t.keys {
+		m[k] = t.floats[i]
+	}
+	return m
+}
+
+func (t table) boolMap() map[string]bool {
+	m := make(map[string]bool, len(t.keys))
+	for i, k := range t.keys {
+		m[k] = t.bools[i]
+	}
+	return m
+}
+
+func (t table) stringMap() stringMap {
+	m := make(stringMap, len(t.keys))
+	for i, k := range t.keys {
+		m[k] = t.strings[i]
+	}
+	return m
+}
+
+func (t table) listMap() listMap {
+	m := make(listMap, len(t.keys))
+	for i, k := range t.keys {
+		m[k] = t.lists[i]
+	}
+	return m
+}
+
+func (t table) nestedMap() nestedMap {
+	m := make(nestedMap)
+	for i, k := range t.keys {
+		outer, inner, _ := strings.Cut(k, "\x00")
+		if m[outer] == nil {
+			m[outer] = make(map[string]float64)
+		}
+		m[outer][inner] = t.floats[i]
+	}
+	return m
+}
+
+// modelSections lists every table of the model and template matcher in the
+// order they are written
+func modelSections(m *model, ft *FitTemplateClass) []section {
+	templates := make(map[string][]string, len(ft.templates))
+	for n, list := range ft.templates {
+		templates[strconv.Itoa(n)] = list
+	}
+	return []section{
+		intSection("hmListMorph", m.hmListMorph),
+		intSection("hmListGaz", m.hmListGaz),
+		intSection("hmAraLexCom", m.hmAraLexCom),
+		intSection("hmBuck", m.hmBuck),
+		intSection("hmLocations", m.hmLocations),
+		intSection("hmPeople", m.hmPeople),
+		intSection("hmStop", m.hmStop),
+		intSection("hPrefixes", intMap(m.hPrefixes)),
+		intSection("hSuffixes", intMap(m.hSuffixes)),
+		boolSection("hmValidSuffixes", m.hmValidSuffixes),
+		boolSection("hmValidPrefixes", m.hmValidPrefixes),
+		boolSection("hmValidSuffixesSegmented", m.hmValidSuffixesSegmented),
+		boolSection("hmValidPrefixesSegmented", m.hmValidPrefixesSegmented),
+		floatSection("hmTemplateCount", asFloatMap(m.hmTemplateCount)),
+		floatSection("wordCount", asFloatMap(m.wordCount)),
+		floatSection("probPrefixes", asFloatMap(m.probPrefixes)),
+		floatSection("probSuffixes", asFloatMap(m.probSuffixes)),
+		floatSection("probCondPrefixes", asFloatMap(m.probCondPrefixes)),
+		floatSection("probCondSuffixes", asFloatMap(m.probCondSuffixes)),
+		floatSection("seenTemplates", m.seenTemplates),
+		floatSection("generalVariables", m.generalVariables),
+		listSection("hmPreviouslySeenTokenizations", asListMap(m.hmPreviouslySeenTokenizations)),
+		listSection("hmWordPossibleSplits", m.hmWordPossibleSplits),
+		nestedSection("probPrefixSuffix", m.probPrefixSuffix),
+		nestedSection("probSuffixPrefix", m.probSuffixPrefix),
+		stringSection("SeenBefore", m.hmSeenBefore),
+		floatSection("roots", ft.hmRoot),
+		floatSection("templateCount", ft.hmTemplate),
+		listSection("templates", templates),
+	}
+}
+
+// ConvertData loads the JSON and text dictionaries in dataDir and writes them
+// to w as a single binary model file that NewFarasa can load
+func ConvertData(dataDir string, w io.Writer) error {
+	return ConvertDataFS(dirFS(dataDir), w)
+}
+
+// ConvertDataFS is ConvertData reading the dictionaries from fsys
+func ConvertDataFS(fsys fs.FS, w io.Writer) error {
+	m := &model{}
+	ft, err := NewFitTemplateClassFS(fsys)
+	if err != nil {
+		return fmt.Errorf("loading fit template: %w", err)
+	}
+	if err := m.loadStoredData(fsys); err != nil {
+		return fmt.Errorf("loading stored data: %w", err)
+	}
+	return writeModel(w, modelSections(m, ft))
+}
+
+func encodeSection(s section) []byte {
+	t := s.tbl
+	var buf []byte
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(t.keys)))
+	off := uint32(0)
+	buf = binary.LittleEndian.AppendUint32(buf, off)
+	for _, k := range t.keys {
+		off += uint32(len(k))
+		buf = binary.LittleEndian.AppendUint32(buf, off)
+	}
+	for _, k := range t.keys {
+		buf = append(buf, k...)
+	}
+
+	switch s.kind {
+	case kindFloat:
+		for _, v := range t.floats {
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+		}
+	case kindBool:
+		for _, v := range t.bools {
+			if v {
+				buf = append(buf, 1)
+			} else {
+				buf = append(buf, 0)
+			}
+		}
+	case kindString, kindList:
+		values := make([][]byte, len(t.keys))
+		for i := range t.keys {
+			if s.kind == kindString {
+				values[i] = []byte(t.strings[i])
+				continue
+			}
+			for _, item := range t.lists[i] {
+				values[i] = binary.AppendUvarint(values[i], uint64(len(item)))
+				values[i] = append(values[i], item...)
+			}
+		}
+		off = 0
+		buf = binary.LittleEndian.AppendUint32(buf, off)
+		for _, v := range values {
+			off += uint32(len(v))
+			buf = binary.LittleEndian.AppendUint32(buf, off)
+		}
+		for _, v := range values {
+			buf = append(buf, v...)
+		}
+	}
+	return buf
+}
+
+func writeModel(w io.Writer, sections []section) error {
+	payloads := make([][]byte, len(sections))
+	headerLen := len(modelMagic) + 8
+	for i, s := range sections {
+		payloads[i] = encodeSection(s)
+		headerLen += 2 + len(s.name) + 1 + 8 + 8
+	}
+
+	var header []byte
+	header = append(header, modelMagic...)
+	header = binary.LittleEndian.AppendUint32(header, modelVersion)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(sections)))
+	offset := uint64(headerLen)
+	for i, s := range sections {
+		header = binary.LittleEndian.AppendUint16(header, uint16(len(s.name)))
+		header = append(header, s.name...)
+		header = append(header, s.kind)
+		header = binary.LittleEndian.AppendUint64(header, offset)
+		header = binary.LittleEndian.AppendUint64(header, uint64(len(payloads[i])))
+		offset += uint64(len(payloads[i]))
+	}
+
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+	bw.Write(header)
+	for _, p := range payloads {
+		bw.Write(p)
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	_, err := w.Write(binary.LittleEndian.AppendUint32(nil, crc.Sum32()))
+	return err
+}
+
+// sectionRef locates a section inside a model file
+type sectionRef struct {
+	kind byte
+	data []byte
+}
+
+// parseModel checks the header and checksum of a model file and returns its
+// sections by name
+func parseModel(data []byte) (map[string]sectionRef, error) {
+	if len(data) < len(modelMagic)+12 || string(data[:len(modelMagic)]) != modelMagic {
+		return nil, fmt.Errorf("%w: bad magic", ErrBadModel)
+	}
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(data[len(data)-4:]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrBadModel)
+	}
+	p := len(modelMagic)
+	if v := binary.LittleEndian.Uint32(body[p:]); v != modelVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrBadModel, v)
+	}
+	n := int(binary.LittleEndian.Uint32(body[p+4:]))
+	p += 8
+
+	sections := make(map[string]sectionRef, n)
+	for i := 0; i < n; i++ {
+		if p+2 > len(body) {
+			return nil, fmt.Errorf("%w: truncated directory", ErrBadModel)
+		}
+		nameLen := int(binary.LittleEndian.Uint16(body[p:]))
+		p += 2
+		if p+nameLen+17 > len(body) {
+			return nil, fmt.Errorf("%w: truncated directory", ErrBadModel)
+		}
+		name := string(body[p : p+nameLen])
+		p += nameLen
+		kind := body[p]
+		offset := binary.LittleEndian.Uint64(body[p+1:])
+		length := binary.LittleEndian.Uint64(body[p+9:])
+		p += 17
+		if offset > uint64(len(body)) || length > uint64(len(body))-offset {
+			return nil, fmt.Errorf("%w: section %s out of range", ErrBadModel, name)
+		}
+		sections[name] = sectionRef{kind: kind, data: body[offset : offset+length]}
+	}
+	return sections, nil
+}
+
+// decodeSection turns a section into a table. Keys and string values share the
+// memory of a single string built from the section.
+func decodeSection(ref sectionRef) (table, error) {
+	var t table
+	data := ref.data
+	bad := fmt.Errorf("%w: corrupt section", ErrBadModel)
+	if len(data) < 4 {
+		return t, bad
+	}
+	n := int(binary.LittleEndian.Uint32(data))
+	p := 4
+	if n < 0 || (len(data)-p)/4 < n+1 {
+		return t, bad
+	}
+	keyOffsets := data[p : p+4*(n+1)]
+	p += 4 * (n + 1)
+	keysLen := int(binary.LittleEndian.Uint32(keyOffsets[4*n:]))
+	if keysLen > len(data)-p {
+		return t, bad
+	}
+	keys := string(data[p : p+keysLen])
+	p += keysLen
+	t.keys = make([]string, n)
+	for i := 0; i < n; i++ {
+		start := binary.LittleEndian.Uint32(keyOffsets[4*i:])
+		end := binary.LittleEndian.Uint32(keyOffsets[4*i+4:])
+		if start > end || int(end) > len(keys) {
+			return t, bad
+		}
+		t.keys[i] = keys[start:end]
+	}
+
+	switch ref.kind {
+	case kindFloat:
+		if len(data)-p < 8*n {
+			return t, bad
+		}
+		t.floats = make([]float64, n)
+		for i := range t.floats {
+			t.floats[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[p+8*i:]))
+		}
+	case kindBool:
+		if len(data)-p < n {
+			return t, bad
+		}
+		t.bools = make([]bool, n)
+		for i := range t.bools {
+			t.bools[i] = data[p+i] != 0
+		}
+	case kindString, kindList:
+		if (len(data)-p)/4 < n+1 {
+			return t, bad
+		}
+		valueOffsets := data[p : p+4*(n+1)]
+		p += 4 * (n + 1)
+		values := string(data[p:])
+		value := func(i int) (string, bool) {
+			start := binary.LittleEndian.Uint32(valueOffsets[4*i:])
+			end := binary.LittleEndian.Uint32(valueOffsets[4*i+4:])
+			if start > end || int(end) > len(values) {
+				return "", false
+			}
+			return values[start:end], true
+		}
+		if ref.kind == kindString {
+			t.strings = make([]string, n)
+		} else {
+			t.lists = make([][]string, n)
+		}
+		for i := 0; i < n; i++ {
+			v, ok := value(i)
+			if !ok {
+				return t, bad
+			}
+			if ref.kind == kindString {
+				t.strings[i] = v
+				continue
+			}
+			list, ok := decodeList(v)
+			if !ok {
+				return t, bad
+			}
+			t.lists[i] = list
+		}
+	default:
+		return t, fmt.Errorf("%w: unknown section kind %d", ErrBadModel, ref.kind)
+	}
+	return t, nil
+}
+
+func decodeList(v string) ([]string, bool) {
+	list := []string{}
+	for len(v) > 0 {
+		l, n := binary.Uvarint([]byte(v[:min(len(v), binary.MaxVarintLen64)]))
+		if n <= 0 || l > uint64(len(v)-n) {
+			return nil, false
+		}
+		list = append(list, v[n:n+int(l)])
+		v = v[n+int(l):]
+	}
+	return list, true
+}
+
+// loadModelFile reads a binary model written by ConvertData
+func loadModelFile(path string, skip map[string]bool) (*model, *FitTemplateClass, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return buildModel(data, false, skip)
+}
+
+// modelLoader turns the sections of a model file into dictionaries. When mapped
+// is set the large dictionaries read directly from data instead of being
+// copied into maps. Sections named in skip are left empty. The first error is
+// kept in err.
+type modelLoader struct {
+	refs   map[string]sectionRef
+	mapped bool
+	skip   map[string]bool
+	err    error
+}
+
+func (l *modelLoader) decode(name string) table {
+	if l.err != nil || l.skip[name] {
+		return table{}
+	}
+	ref, ok := l.refs[name]
+	if !ok {
+		l.err = fmt.Errorf("%w: missing section %s", ErrBadModel, name)
+		return table{}
+	}
+	t, err := decodeSection(ref)
+	if err != nil {
+		l.err = fmt.Errorf("section %s: %w", name, err)
+	}
+	return t
+}
+
+func (l *modelLoader) mappedTable(name string) *mappedTable {
+	if l.err != nil {
+		return &mappedTable{}
+	}
+	ref, ok := l.refs[name]
+	if !ok {
+		l.err = fmt.Errorf("%w: missing section %s", ErrBadModel, name)
+		return &mappedTable{}
+	}
+	t, err := newMappedTable(ref)
+	if err != nil {
+		l.err = fmt.Errorf("section %s: %w", name, err)
+	}
+	return t
+}
+
+func (l *modelLoader) set(name string) setTable {
+	if l.skip[name] {
+		return intMap{}
+	}
+	if l.mapped {
+		return l.mappedTable(name)
+	}
+	return l.decode(name).intMap()
+}
+
+func (l *modelLoader) floats(name string) floatTable {
+	if l.mapped {
+		return mappedFloats{l.mappedTable(name)}
+	}
+	return l.decode(name).floatMap()
+}
+
+func (l *modelLoader) strings(name string) stringTable {
+	if l.skip[name] {
+		return stringMap{}
+	}
+	if l.mapped {
+		return mappedStrings{l.mappedTable(name)}
+	}
+	return l.decode(name).stringMap()
+}
+
+func (l *modelLoader) lists(name string) listTable {
+	if l.skip[name] {
+		return listMap{}
+	}
+	if l.mapped {
+		return mappedLists{l.mappedTable(name)}
+	}
+	return l.decode(name).listMap()
+}
+
+func (l *modelLoader) pairs(name string) pairTable {
+	if l.mapped {
+		return mappedPairs{l.mappedTable(name)}
+	}
+	return l.decode(name).nestedMap()
+}
+
+// buildModel checks a model file and builds the model and template matcher
+// from it. With mapped set the returned dictionaries keep referring to data.
+func buildModel(data []byte, mapped bool, skip map[string]bool) (*model, *FitTemplateClass, error) {
+	refs, err := parseModel(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	l := &modelLoader{refs: refs, mapped: mapped, skip: skip}
+
+	m := &model{
+		hmListMorph:                   l.set("hmListMorph"),
+		hmListGaz:                     l.set("hmListGaz"),
+		hmAraLexCom:                   l.set("hmAraLexCom"),
+		hmBuck:                        l.set("hmBuck"),
+		hmLocations:                   l.set("hmLocations"),
+		hmPeople:                      l.set("hmPeople"),
+		hmStop:                        l.set("hmStop"),
+		hPrefixes:                     l.decode("hPrefixes").intMap(),
+		hSuffixes:                     l.decode("hSuffixes").intMap(),
+		hmValidSuffixes:               l.decode("hmValidSuffixes").boolMap(),
+		hmValidPrefixes:               l.decode("hmValidPrefixes").boolMap(),
+		hmValidSuffixesSegmented:      l.decode("hmValidSuffixesSegmented").boolMap(),
+		hmValidPrefixesSegmented:      l.decode("hmValidPrefixesSegmented").boolMap(),
+		hmTemplateCount:               l.floats("hmTemplateCount"),
+		wordCount:                     l.floats("wordCount"),
+		probPrefixes:                  l.floats("probPrefixes"),
+		probSuffixes:                  l.floats("probSuffixes"),
+		probCondPrefixes:              l.floats("probCondPrefixes"),
+		probCondSuffixes:              l.floats("probCondSuffixes"),
+		seenTemplates:                 l.decode("seenTemplates").floatMap(),
+		generalVariables:              l.decode("generalVariables").floatMap(),
+		hmPreviouslySeenTokenizations: l.lists("hmPreviouslySeenTokenizations"),
+		hmWordPossibleSplits:          l.decode("hmWordPossibleSplits").listMap(),
+		probPrefixSuffix:              l.pairs("probPrefixSuffix"),
+		probSuffixPrefix:              l.pairs("probSuffixPrefix"),
+		hmSeenBefore:                  l.strings("SeenBefore"),
+	}
+
+	ft := &FitTemplateClass{
+		hmRoot:     l.decode("roots").floatMap(),
+		hmTemplate: l.decode("templateCount").floatMap(),
+		templates:  make(map[int][]string),
+	}
+	for n, list := range l.decode("templates").listMap() {
+		length, err := strconv.Atoi(n)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: bad template length %q", ErrBadModel, n)
+		}
+		ft.templates[length] = list
+	}
+	if l.err != nil {
+		return nil, nil, l.err
+	}
+	return m, ft, nil
+}
@@ -0,0 +1,111 @@
+package goahmedfrasa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// convertedModel returns the model file of the dictionary fixture
+func convertedModel(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := ConvertData(testDataDir, &buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestConvertData checks that the model file, loaded or memory-mapped,
+// segments and scores like the data directory it was converted from
+func TestConvertData(t *testing.T) {
+	want := newTestFarasa(t)
+	path := filepath.Join(t.TempDir(), "goahmedfrasa.model")
+	if err := os.WriteFile(path, convertedModel(t), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := NewFarasa(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapped, err := NewFarasaMmap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mapped.Close()
+
+	words := fixtureWords(t)
+	for name, f := range map[string]*Farasa{"loaded": loaded, "mapped": mapped} {
+		for _, w := range words {
+			if got, want := f.MostLikelyPartition(w, math.MaxInt), want.MostLikelyPartition(w, math.MaxInt); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s %s: ranks %v, data directory %v", name, w, got, want)
+			}
+		}
+		for _, opts := range []SegmentOptions{{}, {Scheme: "atb"}, {NoNormalize: true}} {
+			got, _ := f.SegmentWith(strings.Join(words, " "), opts)
+			w, _ := want.SegmentWith(strings.Join(words, " "), opts)
+			if !reflect.DeepEqual(got, w) {
+				t.Errorf("%s %+v: segments differently from the data directory", name, opts)
+			}
+		}
+	}
+}
+
+// withChecksum returns data with its checksum recomputed, so that the damage
+// done to it is found by the other checks
+func withChecksum(data []byte) []byte {
+	body := data[:len(data)-4]
+	return binary.LittleEndian.AppendUint32(append([]byte(nil), body...), crc32.ChecksumIEEE(body))
+}
+
+func TestParseModelErrors(t *testing.T) {
+	good := convertedModel(t)
+	if _, err := parseModel(good); err != nil {
+		t.Fatal(err)
+	}
+	// the directory starts after the magic, version and section count
+	dir := len(modelMagic) + 8
+	nameLen := int(binary.LittleEndian.Uint16(good[dir:]))
+	offset := dir + 2 + nameLen + 1
+
+	tests := []struct {
+		name   string
+		damage func(data []byte) []byte
+		want   string
+	}{
+		{"empty", func([]byte) []byte { return nil }, "bad magic"},
+		{"wrong magic", func(data []byte) []byte {
+			copy(data, "GOFARAXA")
+			return withChecksum(data)
+		}, "bad magic"},
+		{"wrong version", func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(data[len(modelMagic):], modelVersion+1)
+			return withChecksum(data)
+		}, "unsupported version 2"},
+		{"checksum mismatch", func(data []byte) []byte {
+			data[len(data)/2] ^= 0xff
+			return data
+		}, "checksum mismatch"},
+		{"truncated", func(data []byte) []byte { return data[:len(data)-1] }, "checksum mismatch"},
+		{"truncated directory", func(data []byte) []byte {
+			return withChecksum(append(data[:offset], 0, 0, 0, 0))
+		}, "truncated directory"},
+		{"section out of range", func(data []byte) []byte {
+			binary.LittleEndian.PutUint64(data[offset:], uint64(len(data)))
+			return withChecksum(data)
+		}, "out of range"},
+	}
+	for _, tt := range tests {
+		_, err := parseModel(tt.damage(append([]byte(nil), good...)))
+		if !errors.Is(err, ErrBadModel) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: %v, want %v: %s", tt.name, err, ErrBadModel, tt.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package goahmedfrasa
+
+import (
+	"math"
+	"strings"
+)
+
+// Candidate is one entry of an n-best list
+type Candidate struct {
+	Token
+	// Partition is the raw prefix;stem;suffix form
+	Partition string
+	// Probability is the softmax of the candidate's score over all candidates
+	// of the word, scaled by the temperature of the Farasa instance
+	Probability float64
+	// Margin is how much more probable the candidate is than the next one,
+	// which for the best candidate is the runner-up. It is the probability
+	// itself when no candidate follows.
+	Margin float64
+}
+
+// NBest returns the n best segmentations of a single word, best first, with
+// normalized probabilities. The probabilities are comparable across words, so a
+// low top probability or margin flags a word worth reviewing. Unlike Segment,
+// NBest always ranks the generated candidates, even for words found in the
+// SeenBefore dictionary. A negative n returns every candidate.
+func (f *Farasa) NBest(word string, n int, opts SegmentOptions) []Candidate {
+	word = strings.TrimSpace(word)
+	solutions := f.MostLikelyPartition(Buck2UTF8(word), math.MaxInt)
+	if len(solutions) == 0 {
+		return nil
+	}
+	// best first
+	for i, j := 0, len(solutions)-1; i < j; i, j = i+1, j-1 {
+		solutions[i], solutions[j] = solutions[j], solutions[i]
+	}
+	probs := softmax(solutions, f.temperature)
+
+	if n < 0 || n > len(solutions) {
+		n = len(solutions)
+	}
+	out := make([]Candidate, n)
+	for i := range out {
+		sp := solutions[i]
+		out[i] = Candidate{
+			Token:       f.formatToken(word, cleanSegmentation(sp.partition), sp.score, opts),
+			Partition:   sp.partition,
+			Probability: probs[i],
+			Margin:      probs[i],
+		}
+		if i+1 < len(probs) {
+			out[i].Margin = probs[i] - probs[i+1]
+		}
+	}
+	return out
+}
+
+// softmax turns scores into probabilities, with the scores divided by
+// temperature first. Higher temperatures flatten the distribution.
+func softmax(solutions []ScoredPartition, temperature float64) []float64 {
+	top := math.Inf(-1)
+	for _, sp := range solutions {
+		top = math.Max(top, sp.score)
+	}
+	probs := make([]float64, len(solutions))
+	sum := 0.0
+	for i, sp := range solutions {
+		probs[i] = math.Exp((sp.score - top) / temperature)
+		sum += probs[i]
+	}
+	for i := range probs {
+		probs[i] /= sum
+	}
+	return probs
+}
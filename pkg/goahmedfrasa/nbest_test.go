@@ -0,0 +1,61 @@
+package goahmedfrasa
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNBest(t *testing.T) {
+	// the known tokenizations of a word would leave it a single candidate
+	f := newTestFarasa(t, WithoutPreviouslySeenTokenizations())
+	hot := newTestFarasa(t, WithoutPreviouslySeenTokenizations(), WithTemperature(2))
+	for _, word := range []string{"والكتاب", "كتابه", "للتواصل", "بكتاب", "wAlktAb"} {
+		all := f.NBest(word, -1, SegmentOptions{})
+		if len(all) < 2 {
+			t.Fatalf("%s: %d candidates, want several", word, len(all))
+		}
+		sum := 0.0
+		for i, c := range all {
+			sum += c.Probability
+			if i > 0 && c.Probability > all[i-1].Probability {
+				t.Errorf("%s: candidate %d more probable than %d", word, i, i-1)
+			}
+			if want := c.Probability - probabilityAt(all, i+1); math.Abs(c.Margin-want) > 1e-12 {
+				t.Errorf("%s: candidate %d has margin %v, want %v", word, i, c.Margin, want)
+			}
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Errorf("%s: probabilities sum to %v", word, sum)
+		}
+
+		top := f.NBest(word, 2, SegmentOptions{})
+		if len(top) != 2 || top[0].Probability+top[1].Probability > 1 {
+			t.Errorf("%s: best 2 %+v", word, top)
+		}
+
+		// p(a)/p(b) is exp((score(a)-score(b))/T), so doubling T takes its
+		// square root
+		hotAll := hot.NBest(word, -1, SegmentOptions{})
+		if len(hotAll) != len(all) {
+			t.Fatalf("%s: %d candidates at temperature 2, %d at 1", word, len(hotAll), len(all))
+		}
+		for i := 1; i < len(all); i++ {
+			ratio := math.Log(all[0].Probability / all[i].Probability)
+			hotRatio := math.Log(hotAll[0].Probability / hotAll[i].Probability)
+			if want := (all[0].Score - all[i].Score) / 2; math.Abs(hotRatio-want) > 1e-9 || math.Abs(ratio-2*want) > 1e-9 {
+				t.Errorf("%s: candidate %d has log odds %v at temperature 1 and %v at 2, want %v and %v", word, i, ratio, hotRatio, 2*want, want)
+			}
+		}
+		if hotAll[0].Probability > all[0].Probability {
+			t.Errorf("%s: best candidate more probable at temperature 2 (%v) than at 1 (%v)", word, hotAll[0].Probability, all[0].Probability)
+		}
+	}
+}
+
+// probabilityAt is the probability of candidate i, or 0 past the end
+func probabilityAt(cs []Candidate, i int) float64 {
+	if i < len(cs) {
+		return cs[i].Probability
+	}
+	return 0
+}
@@ -0,0 +1,245 @@
+package goahmedfrasa
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// Lexicon names one of the word lists consulted by ScorePartition
+type Lexicon string
+
+const (
+	LexiconMorph      Lexicon = "hmListMorph"
+	LexiconGazetteer  Lexicon = "hmListGaz"
+	LexiconAraLexCom  Lexicon = "hmAraLexCom"
+	LexiconBuckwalter Lexicon = "hmBuck"
+	LexiconLocations  Lexicon = "hmLocations"
+	LexiconPeople     Lexicon = "hmPeople"
+	LexiconStop       Lexicon = "hmStop"
+)
+
+var allLexicons = []Lexicon{
+	LexiconMorph, LexiconGazetteer, LexiconAraLexCom, LexiconBuckwalter,
+	LexiconLocations, LexiconPeople, LexiconStop,
+}
+
+// affixTables are the dictionaries only WithValidAffixes reads, which are not
+// loaded without it
+var affixTables = []string{"hmValidPrefixes", "hmValidSuffixes", "hmWordPossibleSplits"}
+
+// unusedTables are dictionaries of the Java version nothing reads. They stay in
+// binary model files but are never loaded.
+var unusedTables = []string{"hmValidPrefixesSegmented", "hmValidSuffixesSegmented", "seenTemplates"}
+
+// config collects the settings given to the constructors
+type config struct {
+	skip             map[string]bool
+	weights          []float64
+	generalVariables map[string]float64
+	temperature      float64
+	cacheSize        int
+	templateCache    int
+	search           searchLimits
+	validAffixes     bool
+	err              error
+}
+
+// Option configures a Farasa instance
+type Option func(*config)
+
+func newConfig(opts []Option) (*config, error) {
+	cfg := &config{
+		skip:          make(map[string]bool),
+		weights:       defaultWeights,
+		temperature:   1,
+		cacheSize:     defaultCacheSize,
+		templateCache: defaultTemplateCacheSize,
+		search:        defaultSearchLimits,
+	}
+	for _, name := range append(affixTables, unusedTables...) {
+		cfg.skip[name] = true
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.err != nil {
+		return nil, cfg.err
+	}
+	return cfg, nil
+}
+
+// WithoutSeenBefore does not load the SeenBefore dictionary, so every word goes
+// through the scorer
+func WithoutSeenBefore() Option {
+	return func(c *config) {
+		c.skip["SeenBefore"] = true
+	}
+}
+
+// WithoutPreviouslySeenTokenizations does not load the known tokenizations, so
+// candidates are always generated from the word itself
+func WithoutPreviouslySeenTokenizations() Option {
+	return func(c *config) {
+		c.skip["hmPreviouslySeenTokenizations"] = true
+	}
+}
+
+// WithLexicons loads only the given lexicons. The ScorePartition features of the
+// others see every word as missing.
+func WithLexicons(lexicons ...Lexicon) Option {
+	return func(c *config) {
+		keep := make(map[Lexicon]bool, len(lexicons))
+		for _, l := range lexicons {
+			keep[l] = true
+		}
+		for _, l := range allLexicons {
+			c.skip[string(l)] = !keep[l]
+		}
+	}
+}
+
+// WithWeights replaces the weights of the 18 scoring features
+func WithWeights(weights []float64) Option {
+	return func(c *config) {
+		if len(weights) != NumFeatures {
+			c.err = fmt.Errorf("%w: expected %d weights, got %d", ErrBadWeights, NumFeatures, len(weights))
+			return
+		}
+		c.weights = append([]float64(nil), weights...)
+	}
+}
+
+// WithWeightsFile loads the weights of the scoring features from a file in
+// "index:weight" notation, see ReadWeights
+func WithWeightsFile(path string) Option {
+	return func(c *config) {
+		w, err := LoadWeights(path)
+		if err != nil {
+			c.err = err
+			return
+		}
+		c.weights = w
+	}
+}
+
+// WithTemperature sets the temperature NBest divides scores by before
+// normalizing them into probabilities, as found by Calibrate. It defaults to 1.
+func WithTemperature(t float64) Option {
+	return func(c *config) {
+		if !(t > 0) {
+			c.err = fmt.Errorf("temperature must be positive, got %v", t)
+			return
+		}
+		c.temperature = t
+	}
+}
+
+// WithGeneralVariables overrides entries of generalVariables.json, such as
+// averageStemLength or hasTemplate
+func WithGeneralVariables(vars map[string]float64) Option {
+	return func(c *config) {
+		c.generalVariables = vars
+	}
+}
+
+// WithCacheSize bounds the number of segmentations remembered at run time. Zero
+// disables the cache.
+func WithCacheSize(size int) Option {
+	return func(c *config) {
+		c.cacheSize = size
+	}
+}
+
+// WithValidAffixes drops generated candidates whose prefixes or suffixes are
+// not a combination seen in the training data, as listed in hmValidPrefixes and
+// hmValidSuffixes, and takes the candidates of words found in
+// hmWordPossibleSplits from there. Without it these tables are not loaded.
+func WithValidAffixes() Option {
+	return func(c *config) {
+		for _, name := range affixTables {
+			c.skip[name] = false
+		}
+		c.validAffixes = true
+	}
+}
+
+// WithMaxSearchWordLength makes MostLikelyPartition fall back instead of
+// searching the candidates of words longer than n letters, counting the whole
+// word with its affixes. Zero removes the limit.
+func WithMaxSearchWordLength(n int) Option {
+	return func(c *config) {
+		if n < 0 {
+			c.err = fmt.Errorf("maximum search word length must not be negative, got %d", n)
+			return
+		}
+		c.search.maxWordLength = n
+	}
+}
+
+// WithSearchBudget bounds the work MostLikelyPartition spends on one word,
+// counted in combinations of a prefix chain and a suffix chain. Words needing
+// more fall back. Zero removes the limit.
+func WithSearchBudget(n int) Option {
+	return func(c *config) {
+		if n < 0 {
+			c.err = fmt.Errorf("search budget must not be negative, got %d", n)
+			return
+		}
+		c.search.budget = n
+	}
+}
+
+// WithFallback sets what MostLikelyPartition does with words it does not
+// search. It defaults to FallbackAffixes.
+func WithFallback(fb Fallback) Option {
+	return func(c *config) {
+		c.search.fallback = fb
+	}
+}
+
+// WithTemplateCacheSize bounds the number of stems whose FitTemplate result is
+// remembered while scoring. Zero disables the cache.
+func WithTemplateCacheSize(size int) Option {
+	return func(c *config) {
+		c.templateCache = size
+	}
+}
+
+// newFarasa finishes a freshly loaded model according to cfg
+func newFarasa(m *model, ft *FitTemplateClass, cfg *config) *Farasa {
+	m.fillAffixes()
+	if len(cfg.generalVariables) > 0 {
+		vars := make(map[string]float64, len(m.generalVariables)+len(cfg.generalVariables))
+		for k, v := range m.generalVariables {
+			vars[k] = v
+		}
+		for k, v := range cfg.generalVariables {
+			vars[k] = v
+		}
+		m.generalVariables = vars
+	}
+	return &Farasa{
+		model:        m,
+		ft:           ft,
+		weights:      cfg.weights,
+		temperature:  cfg.temperature,
+		search:       cfg.search,
+		validAffixes: cfg.validAffixes,
+		cache:        newShardedCache[cachedSegmentation](cfg.cacheSize),
+		templates:    newShardedCache[string](cfg.templateCache),
+	}
+}
+
+// skipFS hides the JSON files of skipped dictionaries behind an empty object
+type skipFS struct {
+	fs.FS
+	skip map[string]bool
+}
+
+func (s skipFS) ReadFile(name string) ([]byte, error) {
+	if s.skip[strings.TrimSuffix(name, ".json")] {
+		return []byte("{}"), nil
+	}
+	return fs.ReadFile(s.FS, name)
+}
@@ -0,0 +1,238 @@
+package goahmedfrasa
+
+import (
+	"context"
+	"strings"
+)
+
+// MorphemeRole tells whether a morpheme is a prefix, the stem or a suffix
+type MorphemeRole int
+
+const (
+	RolePrefix MorphemeRole = iota
+	RoleStem
+	RoleSuffix
+)
+
+// String returns the lower case name of the role
+func (r MorphemeRole) String() string {
+	switch r {
+	case RolePrefix:
+		return "prefix"
+	case RoleStem:
+		return "stem"
+	case RoleSuffix:
+		return "suffix"
+	}
+	return "unknown"
+}
+
+// Morpheme is one piece of a segmented token. Start and End are rune offsets
+// into the Text of the token the morpheme belongs to, in both schemes and
+// whether or not Text is normalized: the morpheme is written Text[Start:End]
+// before normalization. Letters the segmentation adds, such as the alef of
+// ل+ال in للكتاب, have no offset, so that ال spans the second lam only.
+type Morpheme struct {
+	Text  string
+	Role  MorphemeRole
+	Start int
+	End   int
+}
+
+// Token is a single segmented word
+type Token struct {
+	// Text is the word as produced by Tokenize
+	Text string
+	// Segmented is the segmentation exactly as the command line tool prints it
+	Segmented string
+	// Morphemes holds the prefixes, stem and suffixes in order
+	Morphemes []Morpheme
+	// Score is the ScorePartition score of the chosen segmentation, or zero
+	// when the segmentation came from the SeenBefore dictionary
+	Score float64
+}
+
+// String returns the segmented form of the token
+func (t Token) String() string {
+	return t.Segmented
+}
+
+// SegmentOptions controls how SegmentWith formats its output
+type SegmentOptions struct {
+	// Scheme is "" for the default Farasa scheme or "atb" for Arabic Treebank style
+	Scheme string
+	// NoNormalize disables NormalizeFull on the output
+	NoNormalize bool
+}
+
+// Segment tokenizes text and segments every word using the default scheme
+// with normalization, which is what the command line tool does by default
+func (f *Farasa) Segment(text string) ([]Token, error) {
+	return f.SegmentWith(text, SegmentOptions{})
+}
+
+// SegmentWith tokenizes text and segments every word according to opts
+func (f *Farasa) SegmentWith(text string, opts SegmentOptions) ([]Token, error) {
+	return f.SegmentContext(context.Background(), text, opts)
+}
+
+// SegmentContext is SegmentWith stopping between words once ctx is done. It
+// then returns the tokens segmented so far along with the error of ctx.
+func (f *Farasa) SegmentContext(ctx context.Context, text string, opts SegmentOptions) ([]Token, error) {
+	words := Tokenize(RemoveDiacritics(text))
+	tokens := make([]Token, 0, len(words))
+	for _, w := range words {
+		if err := ctx.Err(); err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, f.segmentToken(w, opts))
+	}
+	return tokens, nil
+}
+
+// segmentWord returns the segmentation of w with the ";" markers removed,
+// consulting the SeenBefore dictionary and the run time cache
+func (f *Farasa) segmentWord(w string) (string, float64) {
+	if seg, ok := f.hmSeenBefore.get(w); ok {
+		return cleanSegmentation(seg), 0
+	}
+	if c, ok := f.cache.get(w); ok {
+		return c.segmentation, c.score
+	}
+	topSolution := w
+	score := 0.0
+	solutions := f.MostLikelyPartition(Buck2UTF8(w), 1)
+	if len(solutions) > 0 {
+		topSolution = solutions[0].GetPartition()
+		score = solutions[0].GetScore()
+	}
+	topSolution = cleanSegmentation(topSolution)
+	f.cache.put(w, cachedSegmentation{topSolution, score})
+	return topSolution, score
+}
+
+func cleanSegmentation(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, ";", ""), "++", "+")
+}
+
+func (f *Farasa) segmentToken(w string, opts SegmentOptions) Token {
+	seg, score := f.segmentWord(w)
+	return f.formatToken(w, seg, score, opts)
+}
+
+// formatToken builds the token for word w from its segmentation seg, which has
+// its ";" markers removed
+func (f *Farasa) formatToken(w, seg string, score float64, opts SegmentOptions) Token {
+	norm := !opts.NoNormalize
+
+	tok := Token{Text: w, Score: score}
+	if opts.Scheme == "atb" {
+		var prefix, stem, suffix string
+		tok.Segmented, prefix, stem, suffix = f.atbSegmentation(seg, norm)
+		_, rawPrefix, rawStem, rawSuffix := f.atbSegmentation(seg, false)
+		spans := morphemeSpans(w, []string{rawPrefix, rawStem, rawSuffix})
+		for i, m := range []Morpheme{{Text: prefix, Role: RolePrefix}, {Text: stem, Role: RoleStem}, {Text: suffix, Role: RoleSuffix}} {
+			if m.Text == "" {
+				continue
+			}
+			m.Start, m.End = spans[i][0], spans[i][1]
+			tok.Morphemes = append(tok.Morphemes, m)
+		}
+		return tok
+	}
+
+	tok.Segmented = seg
+	if norm {
+		tok.Segmented = NormalizeFull(seg)
+	}
+	// normalization keeps the "+" separators, so the pieces of the raw and the
+	// normalized segmentation line up one to one
+	pieces := strings.Split(seg, "+")
+	texts := strings.Split(tok.Segmented, "+")
+	if len(texts) != len(pieces) {
+		texts = pieces
+	}
+	iValidPrefix, iValidSuffix := f.affixBounds(pieces)
+	spans := morphemeSpans(w, pieces)
+	for i, p := range pieces {
+		if p == "" {
+			continue
+		}
+		role := RoleStem
+		if i <= iValidPrefix {
+			role = RolePrefix
+		} else if i >= iValidSuffix {
+			role = RoleSuffix
+		}
+		tok.Morphemes = append(tok.Morphemes, Morpheme{Text: texts[i], Role: role, Start: spans[i][0], End: spans[i][1]})
+	}
+	return tok
+}
+
+// morphemeSpans returns the rune offsets into w of the pieces of its
+// segmentation, which spell w in order, in Arabic letters when w is in
+// Buckwalter, apart from letters the segmentation adds
+func morphemeSpans(w string, pieces []string) [][2]int {
+	letters := []rune(Buck2UTF8(w))
+	spans := make([][2]int, len(pieces))
+	pos := 0
+	for i, p := range pieces {
+		spans[i][0] = pos
+		for _, r := range p {
+			if pos < len(letters) && letters[pos] == r {
+				pos++
+			}
+		}
+		spans[i][1] = pos
+	}
+	return spans
+}
+
+// atbSegmentation converts a segmentation to the Arabic Treebank scheme, where
+// the determiner and ta marbouta stay attached to the stem and the remaining
+// prefixes and suffixes are each concatenated into one token. It returns the
+// formatted output along with the prefix, stem and suffix it is made of.
+func (f *Farasa) atbSegmentation(segmentedWord string, norm bool) (string, string, string, string) {
+	tmp := f.GetProperSegmentation(segmentedWord)
+
+	// attach Al to the word
+	tmp = strings.ReplaceAll(tmp, "\u0627\u0644+;", ";\u0627\u0644")
+
+	// attach ta marbouta
+	tmp = strings.ReplaceAll(tmp, ";+\u0629", "\u0629;")
+
+	// normalize output
+	if norm {
+		tmp = NormalizeFull(tmp)
+	}
+
+	// concat all prefixes and all suffixes
+	parts := strings.Split(" "+tmp+" ", ";")
+
+	output := ""
+
+	// handle prefix
+	prefixPart := strings.ReplaceAll(strings.TrimSpace(parts[0]), "+", "")
+	if len(prefixPart) > 0 {
+		output += prefixPart + "+ "
+	}
+
+	// handle stem
+	stemPart := strings.TrimSpace(parts[1])
+	output += stemPart
+
+	// handle suffix
+	suffixPart := strings.ReplaceAll(strings.TrimSpace(parts[2]), "+", "")
+	if len(suffixPart) > 0 {
+		output += " +" + suffixPart
+	}
+
+	output = strings.TrimSpace(output)
+	for strings.HasPrefix(output, "+") {
+		output = output[1:]
+	}
+	for strings.HasSuffix(output, "+") {
+		output = output[:len(output)-1]
+	}
+	return output, prefixPart, stemPart, suffixPart
+}
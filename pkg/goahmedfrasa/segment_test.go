@@ -0,0 +1,69 @@
+package goahmedfrasa
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestMorphemeOffsets checks that Start and End index the token text the same
+// way in both schemes, whether or not the morphemes are normalized
+func TestMorphemeOffsets(t *testing.T) {
+	f := newTestFarasa(t)
+	tests := []struct {
+		scheme string
+		text   string
+		want   []Morpheme
+	}{
+		{"", "والكتاب", []Morpheme{{"و", RolePrefix, 0, 1}, {"ال", RolePrefix, 1, 3}, {"كتاب", RoleStem, 3, 7}}},
+		{"", "wAlktAb", []Morpheme{{"و", RolePrefix, 0, 1}, {"ال", RolePrefix, 1, 3}, {"كتاب", RoleStem, 3, 7}}},
+		{"", "أسئلة", []Morpheme{{"أسئل", RoleStem, 0, 4}, {"ة", RoleSuffix, 4, 5}}},
+		// the alef of ال is added, so ال spans the second lam only
+		{"", "وللكتاب", []Morpheme{{"و", RolePrefix, 0, 1}, {"ل", RolePrefix, 1, 2}, {"ال", RolePrefix, 2, 3}, {"كتاب", RoleStem, 3, 7}}},
+		{"atb", "والكتاب", []Morpheme{{"و", RolePrefix, 0, 1}, {"الكتاب", RoleStem, 1, 7}}},
+		{"atb", "أسئلة", []Morpheme{{"أسئلة", RoleStem, 0, 5}}},
+		{"atb", "وللكتاب", []Morpheme{{"ول", RolePrefix, 0, 2}, {"الكتاب", RoleStem, 2, 7}}},
+	}
+	for _, tt := range tests {
+		for _, noNormalize := range []bool{true, false} {
+			tokens, err := f.SegmentWith(tt.text, SegmentOptions{Scheme: tt.scheme, NoNormalize: noNormalize})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tokens) != 1 {
+				t.Fatalf("%s: %d tokens", tt.text, len(tokens))
+			}
+			got := tokens[0].Morphemes
+			if len(got) != len(tt.want) {
+				t.Errorf("%q %s NoNormalize=%v: %+v, want %+v", tt.scheme, tt.text, noNormalize, got, tt.want)
+				continue
+			}
+			for i, m := range got {
+				w := tt.want[i]
+				if m.Role != w.Role || m.Start != w.Start || m.End != w.End {
+					t.Errorf("%q %s NoNormalize=%v: morpheme %d is %+v, want %+v", tt.scheme, tt.text, noNormalize, i, m, w)
+				}
+				if noNormalize && m.Text != w.Text {
+					t.Errorf("%q %s: morpheme %d is %q, want %q", tt.scheme, tt.text, i, m.Text, w.Text)
+				}
+			}
+		}
+	}
+}
+
+func TestMorphemeSpans(t *testing.T) {
+	tests := []struct {
+		w      string
+		pieces []string
+		want   [][2]int
+	}{
+		{"والكتاب", []string{"و", "ال", "كتاب"}, [][2]int{{0, 1}, {1, 3}, {3, 7}}},
+		{"wAlktAb", []string{"و", "ال", "كتاب"}, [][2]int{{0, 1}, {1, 3}, {3, 7}}},
+		{"للكتاب", []string{"ل", "ال", "كتاب"}, [][2]int{{0, 1}, {1, 2}, {2, 6}}},
+		{"كتابه", []string{"", "كتاب", "ه"}, [][2]int{{0, 0}, {0, 4}, {4, 5}}},
+	}
+	for _, tt := range tests {
+		if got := morphemeSpans(tt.w, tt.pieces); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("morphemeSpans(%s, %q) = %v, want %v", tt.w, tt.pieces, got, tt.want)
+		}
+	}
+}
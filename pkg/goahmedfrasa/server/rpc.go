@@ -0,0 +1,177 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"goahmedfrasa/pkg/goahmedfrasa"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	// rpcServerError reports a request the server gave up on, such as one
+	// cancelled when ServeRPC stops
+	rpcServerError = -32000
+)
+
+// maxRPCInFlight bounds the number of requests ServeRPC works on at once
+const maxRPCInFlight = 64
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	// ID is nil for notifications, which get no response
+	ID json.RawMessage `json:"id"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// TextResponse is the result of the normalize and transliterate methods
+type TextResponse struct {
+	Text string `json:"text"`
+}
+
+// rpcMethods maps the JSON-RPC methods to their implementation. The params
+// of every method are a Request object.
+var rpcMethods = map[string]func(ctx context.Context, f *goahmedfrasa.Farasa, req *Request) (any, error){
+	"segment": func(ctx context.Context, f *goahmedfrasa.Farasa, req *Request) (any, error) {
+		return Segment(ctx, f, req)
+	},
+	"nbest": func(_ context.Context, f *goahmedfrasa.Farasa, req *Request) (any, error) {
+		return NBest(f, req)
+	},
+	"explain": func(_ context.Context, f *goahmedfrasa.Farasa, req *Request) (any, error) {
+		return Explain(f, req)
+	},
+	"fitTemplate": func(_ context.Context, f *goahmedfrasa.Farasa, req *Request) (any, error) {
+		return Template(f, req)
+	},
+	"normalize": func(_ context.Context, _ *goahmedfrasa.Farasa, req *Request) (any, error) {
+		return &TextResponse{Text: goahmedfrasa.NormalizeFull(req.Text)}, nil
+	},
+	"transliterate": func(_ context.Context, _ *goahmedfrasa.Farasa, req *Request) (any, error) {
+		switch req.To {
+		case "", "buckwalter":
+			return &TextResponse{Text: goahmedfrasa.UTF82Buck(req.Text)}, nil
+		case "arabic":
+			return &TextResponse{Text: goahmedfrasa.Buck2UTF8(req.Text)}, nil
+		}
+		return nil, fmt.Errorf("unknown transliteration target %q", req.To)
+	},
+}
+
+// ServeRPC answers JSON-RPC 2.0 requests read from r, one per line, until r
+// ends or ctx is done. The methods are segment, nbest, explain, fitTemplate,
+// normalize and transliterate, taking the fields of Request as named params.
+// Requests are handled concurrently and every response is written to w as one
+// line as soon as it is ready, so responses may come in a different order than
+// the requests; the id tells them apart. Batches are not supported.
+//
+// ServeRPC blocks reading r, so it only notices that ctx is done when the next
+// request line comes in, which is still handled, with ctx, before it stops.
+// Closing r stops it sooner. It returns the read error of r, or nil at the end
+// of r or once ctx is done.
+func ServeRPC(ctx context.Context, f *goahmedfrasa.Farasa, r io.Reader, w io.Writer) error {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	respond := func(resp *rpcResponse) {
+		resp.JSONRPC = "2.0"
+		if resp.ID == nil {
+			resp.ID = json.RawMessage("null")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if err := enc.Encode(resp); err != nil {
+			// a result that cannot be encoded still gets an answer
+			enc.Encode(&rpcResponse{JSONRPC: "2.0", Error: &rpcError{-32603, err.Error()}, ID: resp.ID})
+		}
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	inFlight := make(chan struct{}, maxRPCInFlight)
+	reader := bufio.NewReader(r)
+	for ctx.Err() == nil {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var req rpcRequest
+			if jerr := json.Unmarshal(line, &req); jerr != nil {
+				code := rpcParseError
+				var typeErr *json.UnmarshalTypeError
+				if errors.As(jerr, &typeErr) {
+					code = rpcInvalidRequest
+				}
+				respond(&rpcResponse{Error: &rpcError{code, jerr.Error()}})
+			} else {
+				inFlight <- struct{}{}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-inFlight }()
+					resp := callRPC(ctx, f, &req)
+					if req.ID != nil {
+						resp.ID = req.ID
+						respond(resp)
+					}
+				}()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// callRPC runs one request
+func callRPC(ctx context.Context, f *goahmedfrasa.Farasa, req *rpcRequest) *rpcResponse {
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return &rpcResponse{Error: &rpcError{rpcInvalidRequest, `expected "jsonrpc": "2.0" and a method`}}
+	}
+	method, ok := rpcMethods[req.Method]
+	if !ok {
+		return &rpcResponse{Error: &rpcError{rpcMethodNotFound, "unknown method " + req.Method}}
+	}
+	params := &Request{}
+	if len(req.Params) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(req.Params))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(params); err != nil {
+			return &rpcResponse{Error: &rpcError{rpcInvalidParams, err.Error()}}
+		}
+	}
+	result, err := method(ctx, f, params)
+	if err != nil {
+		code := rpcInvalidParams
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			code = rpcServerError
+		}
+		return &rpcResponse{Error: &rpcError{code, err.Error()}}
+	}
+	return &rpcResponse{Result: result}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestServeRPC(t *testing.T) {
+	f := loadTestFarasa(t)
+	requests := strings.Join([]string{
+		`{"jsonrpc": "2.0", "id": 1, "method": "segment", "params": {"text": "والكتاب"}}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "segment", "params": {"text": "x", "scheme": "xyz"}}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "segment", "params": {"txt": "x"}}`,
+		`{"jsonrpc": "2.0", "id": 4, "method": "stem"}`,
+		`{"jsonrpc": "2.0", "id": 5, "method": "transliterate", "params": {"text": "كتب"}}`,
+		`{"jsonrpc": "2.0", "method": "segment", "params": {"text": "notification"}}`,
+		`{"jsonrpc": "2.0", "id": 6`,
+	}, "\n")
+	var out strings.Builder
+	if err := ServeRPC(context.Background(), f, strings.NewReader(requests), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	type response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+		ID     json.RawMessage `json:"id"`
+	}
+	// responses come in any order
+	responses := make(map[string]response)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var r response
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		responses[string(r.ID)] = r
+	}
+	if len(responses) != 6 {
+		t.Fatalf("%d responses, want 6:\n%s", len(responses), out.String())
+	}
+	// the parse error has no id
+	wantCodes := map[string]int{"null": rpcParseError, "2": rpcInvalidParams, "3": rpcInvalidParams, "4": rpcMethodNotFound}
+	for id, r := range responses {
+		code := 0
+		if r.Error != nil {
+			code = r.Error.Code
+		}
+		if code != wantCodes[id] {
+			t.Errorf("id %s: error %+v, want code %d", id, r.Error, wantCodes[id])
+		}
+	}
+	var text TextResponse
+	if err := json.Unmarshal(responses["5"].Result, &text); err != nil || text.Text != "ktb" {
+		t.Errorf("transliterate: %s", responses["5"].Result)
+	}
+}
+
+// TestRPCCancelled checks that a request cut short by the context is a server
+// error, not a params error
+func TestRPCCancelled(t *testing.T) {
+	f := loadTestFarasa(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	resp := callRPC(ctx, f, &rpcRequest{JSONRPC: "2.0", Method: "segment", Params: json.RawMessage(`{"text": "والكتاب"}`)})
+	if resp.Error == nil || resp.Error.Code != rpcServerError {
+		t.Errorf("cancelled segment: error %+v, want code %d", resp.Error, rpcServerError)
+	}
+}
@@ -0,0 +1,388 @@
+// Package server exposes a Farasa segmenter over HTTP with JSON requests and
+// responses.
+//
+// Every endpoint takes its parameters either as query parameters of a GET
+// request or as a JSON object in the body of a POST request, see Request:
+//
+//	/segment   text                 segment text
+//	/nbest     word, n              the n best segmentations of a word
+//	/explain   word, top            the score breakdown of a word's candidates
+//	/template  stem                 the template and root a stem fits
+//	/healthz                        200 while the process is up
+//	/readyz                         200 once the model is loaded, 503 before
+//	                                that and while shutting down
+//
+// segment and nbest also take scheme ("" or "atb") and normalize (default
+// true). Errors are reported as {"error": "..."} with a 4xx or 5xx status.
+//
+// ServeRPC offers the same operations as JSON-RPC 2.0 methods over any pair of
+// streams, one message per line.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"goahmedfrasa/pkg/goahmedfrasa"
+)
+
+// maxBodySize bounds the JSON body of a request
+const maxBodySize = 10 << 20
+
+// shutdownTimeout is how long ListenAndServe waits for running requests when
+// shutting down
+const shutdownTimeout = 10 * time.Second
+
+// Server is an http.Handler serving the endpoints of the package. It answers
+// 503 until a segmenter is set.
+type Server struct {
+	farasa   atomic.Pointer[goahmedfrasa.Farasa]
+	draining atomic.Bool
+	mux      *http.ServeMux
+}
+
+// New returns a server using f, which may be nil until SetFarasa is called
+func New(f *goahmedfrasa.Farasa) *Server {
+	s := &Server{mux: http.NewServeMux()}
+	s.farasa.Store(f)
+	s.mux.HandleFunc("/segment", s.handle(func(ctx context.Context, f *goahmedfrasa.Farasa, req *Request) (any, error) {
+		return Segment(ctx, f, req)
+	}))
+	s.mux.HandleFunc("/nbest", s.handle(func(_ context.Context, f *goahmedfrasa.Farasa, req *Request) (any, error) {
+		return NBest(f, req)
+	}))
+	s.mux.HandleFunc("/explain", s.handle(func(_ context.Context, f *goahmedfrasa.Farasa, req *Request) (any, error) {
+		return Explain(f, req)
+	}))
+	s.mux.HandleFunc("/template", s.handle(func(_ context.Context, f *goahmedfrasa.Farasa, req *Request) (any, error) {
+		return Template(f, req)
+	}))
+	s.mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	s.mux.HandleFunc("/readyz", s.ready)
+	return s
+}
+
+// SetFarasa sets the segmenter, for loading the model after the server started
+// answering health checks
+func (s *Server) SetFarasa(f *goahmedfrasa.Farasa) {
+	s.farasa.Store(f)
+}
+
+// Drain makes /readyz fail so that load balancers stop sending requests
+func (s *Server) Drain() {
+	s.draining.Store(true)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves on addr until ctx is done, then drains, lets running
+// requests finish for up to ten seconds and returns nil
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve is ListenAndServe on an existing listener
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(ln)
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	s.Drain()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) ready(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case s.draining.Load():
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "draining"})
+	case s.farasa.Load() == nil:
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "loading"})
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+	}
+}
+
+// Request holds the parameters of all endpoints. Each endpoint reads the ones
+// it needs.
+type Request struct {
+	Text string `json:"text,omitempty"`
+	Word string `json:"word,omitempty"`
+	Stem string `json:"stem,omitempty"`
+	// N is the number of segmentations nbest returns, 5 if zero, all if
+	// negative
+	N int `json:"n,omitempty"`
+	// Top is the number of candidates explain returns, all if zero
+	Top    int    `json:"top,omitempty"`
+	Scheme string `json:"scheme,omitempty"`
+	// Normalize turns normalization of the output off when false
+	Normalize *bool `json:"normalize,omitempty"`
+	// To is the script the transliterate method of ServeRPC converts text
+	// to, "buckwalter" (the default) or "arabic"
+	To string `json:"to,omitempty"`
+}
+
+// SegmentOptions returns the segmentation options of the request
+func (req *Request) SegmentOptions() (goahmedfrasa.SegmentOptions, error) {
+	if req.Scheme != "" && req.Scheme != "atb" {
+		return goahmedfrasa.SegmentOptions{}, fmt.Errorf("unknown scheme %q", req.Scheme)
+	}
+	return goahmedfrasa.SegmentOptions{
+		Scheme:      req.Scheme,
+		NoNormalize: req.Normalize != nil && !*req.Normalize,
+	}, nil
+}
+
+// Morpheme is goahmedfrasa.Morpheme with the role spelled out
+type Morpheme struct {
+	Text  string `json:"text"`
+	Role  string `json:"role"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// Token is a segmented word
+type Token struct {
+	Text      string     `json:"text"`
+	Segmented string     `json:"segmented"`
+	Score     float64    `json:"score"`
+	Morphemes []Morpheme `json:"morphemes"`
+}
+
+// SegmentResponse is the response of /segment. Segmented is the text as the
+// command line tool prints it, without the trailing space.
+type SegmentResponse struct {
+	Segmented string  `json:"segmented"`
+	Tokens    []Token `json:"tokens"`
+}
+
+// NBestEntry is one of the segmentations of NBestResponse
+type NBestEntry struct {
+	Segmentation string  `json:"segmentation"`
+	Partition    string  `json:"partition"`
+	Score        float64 `json:"score"`
+	Probability  float64 `json:"probability"`
+	Margin       float64 `json:"margin"`
+}
+
+// NBestResponse is the response of /nbest. Segmentation is what /segment
+// returns for the word.
+type NBestResponse struct {
+	Word         string       `json:"word"`
+	Segmentation string       `json:"segmentation"`
+	NBest        []NBestEntry `json:"nbest"`
+}
+
+// TemplateResponse is the response of /template. Template is "Y" and the roots
+// are empty when no template fits. Root is in the transliteration of roots.txt.
+type TemplateResponse struct {
+	Stem       string `json:"stem"`
+	Template   string `json:"template"`
+	Root       string `json:"root"`
+	RootArabic string `json:"rootArabic"`
+}
+
+// Segment serves /segment
+func Segment(ctx context.Context, f *goahmedfrasa.Farasa, req *Request) (*SegmentResponse, error) {
+	opts, err := req.SegmentOptions()
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := f.SegmentContext(ctx, req.Text, opts)
+	if err != nil {
+		return nil, err
+	}
+	resp := &SegmentResponse{Tokens: make([]Token, 0, len(tokens))}
+	segmented := make([]string, 0, len(tokens))
+	for _, tok := range tokens {
+		resp.Tokens = append(resp.Tokens, newToken(tok))
+		segmented = append(segmented, tok.Segmented)
+	}
+	resp.Segmented = strings.Join(segmented, " ")
+	return resp, nil
+}
+
+// NBest serves /nbest
+func NBest(f *goahmedfrasa.Farasa, req *Request) (*NBestResponse, error) {
+	opts, err := req.SegmentOptions()
+	if err != nil {
+		return nil, err
+	}
+	word, err := singleWord(req.Word)
+	if err != nil {
+		return nil, err
+	}
+	n := req.N
+	if n == 0 {
+		n = 5
+	}
+	resp := &NBestResponse{Word: word, NBest: []NBestEntry{}}
+	if tokens, _ := f.SegmentWith(word, opts); len(tokens) > 0 {
+		resp.Segmentation = tokens[0].Segmented
+	}
+	for _, c := range f.NBest(word, n, opts) {
+		resp.NBest = append(resp.NBest, NBestEntry{
+			Segmentation: c.Segmented,
+			Partition:    c.Partition,
+			Score:        c.Score,
+			Probability:  c.Probability,
+			Margin:       c.Margin,
+		})
+	}
+	return resp, nil
+}
+
+// Explain serves /explain
+func Explain(f *goahmedfrasa.Farasa, req *Request) (*goahmedfrasa.Explanation, error) {
+	word, err := singleWord(req.Word)
+	if err != nil {
+		return nil, err
+	}
+	e := f.Explain(word)
+	if req.Top > 0 && len(e.Candidates) > req.Top {
+		e.Candidates = e.Candidates[:req.Top]
+	}
+	return &e, nil
+}
+
+// Template serves /template
+func Template(f *goahmedfrasa.Farasa, req *Request) (*TemplateResponse, error) {
+	stem := strings.TrimSpace(req.Stem)
+	if stem == "" {
+		return nil, errors.New("missing stem")
+	}
+	template, root := f.FitTemplate(stem)
+	return &TemplateResponse{
+		Stem:       stem,
+		Template:   template,
+		Root:       root,
+		RootArabic: goahmedfrasa.RootToUTF8(root),
+	}, nil
+}
+
+// singleWord returns word as Tokenize sees it, failing unless it is exactly
+// one token
+func singleWord(word string) (string, error) {
+	tokens := goahmedfrasa.Tokenize(goahmedfrasa.RemoveDiacritics(word))
+	if len(tokens) != 1 {
+		return "", fmt.Errorf("expected a single word, got %d", len(tokens))
+	}
+	return tokens[0], nil
+}
+
+func newToken(tok goahmedfrasa.Token) Token {
+	t := Token{Text: tok.Text, Segmented: tok.Segmented, Score: tok.Score, Morphemes: make([]Morpheme, 0, len(tok.Morphemes))}
+	for _, m := range tok.Morphemes {
+		t.Morphemes = append(t.Morphemes, Morpheme{Text: m.Text, Role: m.Role.String(), Start: m.Start, End: m.End})
+	}
+	return t
+}
+
+// handle adapts an endpoint to http.HandlerFunc. It parses the request, checks
+// that a segmenter is loaded and writes the result or error as JSON.
+func (s *Server) handle(endpoint func(ctx context.Context, f *goahmedfrasa.Farasa, req *Request) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f := s.farasa.Load()
+		if f == nil {
+			writeError(w, http.StatusServiceUnavailable, errors.New("model not loaded yet"))
+			return
+		}
+		req, err := parseRequest(w, r)
+		if err != nil {
+			status := http.StatusBadRequest
+			if r.Method != http.MethodGet && r.Method != http.MethodPost {
+				w.Header().Set("Allow", "GET, POST")
+				status = http.StatusMethodNotAllowed
+			}
+			writeError(w, status, err)
+			return
+		}
+		resp, err := endpoint(r.Context(), f, req)
+		if err != nil {
+			status := http.StatusBadRequest
+			if r.Context().Err() != nil {
+				status = http.StatusServiceUnavailable
+			}
+			writeError(w, status, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// parseRequest reads the parameters from the query of a GET request or the
+// JSON body of a POST request
+func parseRequest(w http.ResponseWriter, r *http.Request) (*Request, error) {
+	req := &Request{}
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Text, req.Word, req.Stem, req.Scheme = q.Get("text"), q.Get("word"), q.Get("stem"), q.Get("scheme")
+		for name, target := range map[string]*int{"n": &req.N, "top": &req.Top} {
+			if v := q.Get(name); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					return nil, fmt.Errorf("bad %s: %w", name, err)
+				}
+				*target = n
+			}
+		}
+		if v := q.Get("normalize"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("bad normalize: %w", err)
+			}
+			req.Normalize = &b
+		}
+	case http.MethodPost:
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(req); err != nil {
+			return nil, fmt.Errorf("bad request body: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("method %s not allowed", r.Method)
+	}
+	return req, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"goahmedfrasa/pkg/goahmedfrasa"
+)
+
+var (
+	testFarasaOnce sync.Once
+	testFarasa     *goahmedfrasa.Farasa
+	testFarasaErr  error
+)
+
+// loadTestFarasa returns the segmenter loaded from the dictionary fixture in
+// testdata/data
+func loadTestFarasa(t *testing.T) *goahmedfrasa.Farasa {
+	t.Helper()
+	testFarasaOnce.Do(func() {
+		testFarasa, testFarasaErr = goahmedfrasa.NewFarasa("../../../testdata/data/")
+	})
+	if testFarasaErr != nil {
+		t.Fatal(testFarasaErr)
+	}
+	return testFarasa
+}
+
+// newTestServer serves the segmenter of loadTestFarasa
+func newTestServer(t *testing.T) (*httptest.Server, *goahmedfrasa.Farasa) {
+	t.Helper()
+	f := loadTestFarasa(t)
+	ts := httptest.NewServer(New(f))
+	t.Cleanup(ts.Close)
+	return ts, f
+}
+
+// do sends a request with an optional JSON body and decodes the JSON response
+// into v
+func do(t *testing.T, method, target, body string, v any) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, target, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("%s %s: Content-Type %q", method, target, ct)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("%s %s: decoding the response: %v", method, target, err)
+	}
+	return resp
+}
+
+func TestSegmentEndpoint(t *testing.T) {
+	ts, f := newTestServer(t)
+	text := "والكتاب مشروب"
+	tokens, _ := f.SegmentWith(text, goahmedfrasa.SegmentOptions{})
+	var want []string
+	for _, tok := range tokens {
+		want = append(want, tok.Segmented)
+	}
+
+	body, _ := json.Marshal(Request{Text: text})
+	var post SegmentResponse
+	if resp := do(t, http.MethodPost, ts.URL+"/segment", string(body), &post); resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST status %d", resp.StatusCode)
+	}
+	if post.Segmented != strings.Join(want, " ") {
+		t.Errorf("POST segmented %q, want %q", post.Segmented, strings.Join(want, " "))
+	}
+	if len(post.Tokens) != len(tokens) {
+		t.Fatalf("POST %d tokens, want %d", len(post.Tokens), len(tokens))
+	}
+	for i, tok := range post.Tokens {
+		if tok.Text != tokens[i].Text || len(tok.Morphemes) != len(tokens[i].Morphemes) {
+			t.Errorf("token %d: %+v, want %+v", i, tok, tokens[i])
+		}
+	}
+
+	var get SegmentResponse
+	if resp := do(t, http.MethodGet, ts.URL+"/segment?text="+url.QueryEscape(text), "", &get); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET status %d", resp.StatusCode)
+	}
+	if get.Segmented != post.Segmented {
+		t.Errorf("GET segmented %q, POST %q", get.Segmented, post.Segmented)
+	}
+}
+
+func TestNBestEndpoint(t *testing.T) {
+	ts, _ := newTestServer(t)
+	var nb NBestResponse
+	resp := do(t, http.MethodPost, ts.URL+"/nbest", `{"word": "والكتاب", "n": 3}`, &nb)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	if len(nb.NBest) == 0 || len(nb.NBest) > 3 {
+		t.Fatalf("%d segmentations, want 1 to 3", len(nb.NBest))
+	}
+	if nb.NBest[0].Segmentation != nb.Segmentation {
+		t.Errorf("best %q, segmentation %q", nb.NBest[0].Segmentation, nb.Segmentation)
+	}
+	for i := 1; i < len(nb.NBest); i++ {
+		if nb.NBest[i].Probability > nb.NBest[i-1].Probability {
+			t.Errorf("segmentation %d is more probable than %d", i, i-1)
+		}
+	}
+
+	var e map[string]string
+	if resp := do(t, http.MethodGet, ts.URL+"/nbest?word=a+b", "", &e); resp.StatusCode != http.StatusBadRequest || e["error"] == "" {
+		t.Errorf("two words: status %d, error %q", resp.StatusCode, e["error"])
+	}
+}
+
+func TestTemplateEndpoint(t *testing.T) {
+	ts, _ := newTestServer(t)
+	tests := []struct {
+		stem, template, root, rootArabic string
+	}{
+		{"مشروب", "mfEwl", "Prb", "شرب"},
+		{"مذهب", "mfEl", "Ohb", "ذهب"},
+	}
+	for _, tt := range tests {
+		var got TemplateResponse
+		if resp := do(t, http.MethodGet, ts.URL+"/template?stem="+url.QueryEscape(tt.stem), "", &got); resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status %d", tt.stem, resp.StatusCode)
+		}
+		want := TemplateResponse{tt.stem, tt.template, tt.root, tt.rootArabic}
+		if got != want {
+			t.Errorf("%s: %+v, want %+v", tt.stem, got, want)
+		}
+	}
+}
+
+func TestBadRequests(t *testing.T) {
+	ts, _ := newTestServer(t)
+	tests := []struct {
+		name, method, path, body string
+		status                   int
+	}{
+		{"bad JSON", http.MethodPost, "/segment", `{"text": `, http.StatusBadRequest},
+		{"unknown field", http.MethodPost, "/segment", `{"txt": "x"}`, http.StatusBadRequest},
+		{"bad scheme", http.MethodPost, "/segment", `{"text": "x", "scheme": "xyz"}`, http.StatusBadRequest},
+		{"bad n", http.MethodGet, "/nbest?word=x&n=many", "", http.StatusBadRequest},
+		{"missing stem", http.MethodGet, "/template", "", http.StatusBadRequest},
+		{"wrong method", http.MethodPut, "/segment", `{"text": "x"}`, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		var e map[string]string
+		resp := do(t, tt.method, ts.URL+tt.path, tt.body, &e)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+		if e["error"] == "" {
+			t.Errorf("%s: no error message", tt.name)
+		}
+		allow := resp.Header.Get("Allow")
+		if tt.status == http.StatusMethodNotAllowed && allow != "GET, POST" {
+			t.Errorf("%s: Allow %q, want GET, POST", tt.name, allow)
+		}
+	}
+}
+
+// TestNotLoaded checks the answers before the model is set, which need no
+// dictionaries
+func TestNotLoaded(t *testing.T) {
+	ts := httptest.NewServer(New(nil))
+	defer ts.Close()
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/healthz", http.StatusOK},
+		{"/readyz", http.StatusServiceUnavailable},
+		{"/segment?text=x", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		var body map[string]string
+		if resp := do(t, http.MethodGet, ts.URL+tt.path, "", &body); resp.StatusCode != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.path, resp.StatusCode, tt.status)
+		}
+	}
+}
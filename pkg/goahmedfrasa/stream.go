@@ -0,0 +1,149 @@
+package goahmedfrasa
+
+import (
+	"bytes"
+	"io"
+)
+
+// streamChunk is the amount of input read at a time, and the size beyond
+// which a line is segmented up to its last space before the line has ended
+const streamChunk = 64 * 1024
+
+// streamSegmenter turns text fed in arbitrary pieces into segmented text in
+// the format of the command line tool: every word followed by a space and
+// every line ended by a newline. Words never contain spaces, so a long line is
+// segmented piecewise at spaces with the same result as in one go.
+type streamSegmenter struct {
+	f       *Farasa
+	opts    SegmentOptions
+	pending []byte
+	// spaceless is the length of the start of pending known to hold no space,
+	// so that a long line fed a little at a time is not searched over again
+	spaceless int
+}
+
+// feed appends p to the input and writes the output of every complete line
+// to out
+func (s *streamSegmenter) feed(p []byte, out *bytes.Buffer) {
+	from := len(s.pending)
+	s.pending = append(s.pending, p...)
+	start := 0
+	for {
+		i := bytes.IndexByte(s.pending[from:], '\n')
+		if i < 0 {
+			break
+		}
+		s.segment(bytes.TrimSuffix(s.pending[start:from+i], []byte("\r")), out)
+		out.WriteByte('\n')
+		start = from + i + 1
+		from = start
+		s.spaceless = 0
+	}
+	rest := s.pending[start:]
+	if len(rest) > streamChunk {
+		if i := bytes.LastIndexAny(rest[s.spaceless:], " \t"); i >= 0 {
+			s.segment(rest[:s.spaceless+i], out)
+			rest = rest[s.spaceless+i+1:]
+			s.spaceless = 0
+		} else {
+			s.spaceless = len(rest)
+		}
+	}
+	s.pending = append(s.pending[:0], rest...)
+}
+
+// flush ends the input, writing the output of an unterminated last line to out
+func (s *streamSegmenter) flush(out *bytes.Buffer) {
+	if len(s.pending) > 0 {
+		s.segment(bytes.TrimSuffix(s.pending, []byte("\r")), out)
+		out.WriteByte('\n')
+		s.pending = s.pending[:0]
+		s.spaceless = 0
+	}
+}
+
+func (s *streamSegmenter) segment(text []byte, out *bytes.Buffer) {
+	tokens, _ := s.f.SegmentWith(string(text), s.opts)
+	for _, tok := range tokens {
+		out.WriteString(tok.Segmented)
+		out.WriteByte(' ')
+	}
+}
+
+// SegmentingReader is an io.Reader returning the text of another reader
+// segmented, see NewSegmentingReader
+type SegmentingReader struct {
+	r   io.Reader
+	s   streamSegmenter
+	buf []byte
+	out bytes.Buffer
+	err error
+}
+
+// NewSegmentingReader returns a reader of the text of r segmented according to
+// opts, in the format of the command line tool: every word followed by a space
+// and every line ended by a newline. Input is read and segmented in chunks, so
+// lines may be of any length. Read errors of r other than io.EOF are returned
+// once the text read before them has been consumed.
+func NewSegmentingReader(r io.Reader, f *Farasa, opts SegmentOptions) *SegmentingReader {
+	return &SegmentingReader{r: r, s: streamSegmenter{f: f, opts: opts}}
+}
+
+// Read reads segmented text into p
+func (sr *SegmentingReader) Read(p []byte) (int, error) {
+	for sr.out.Len() == 0 && sr.err == nil {
+		if sr.buf == nil {
+			sr.buf = make([]byte, streamChunk)
+		}
+		n, err := sr.r.Read(sr.buf)
+		sr.s.feed(sr.buf[:n], &sr.out)
+		if err != nil {
+			sr.s.flush(&sr.out)
+			sr.err = err
+		}
+	}
+	if sr.out.Len() > 0 {
+		return sr.out.Read(p)
+	}
+	return 0, sr.err
+}
+
+// SegmentingWriter is an io.WriteCloser segmenting the text written to it, see
+// NewSegmentingWriter
+type SegmentingWriter struct {
+	w   io.Writer
+	s   streamSegmenter
+	out bytes.Buffer
+}
+
+// NewSegmentingWriter returns a writer that segments the text written to it
+// according to opts and writes the result to w, in the same format as
+// NewSegmentingReader. Output is written as soon as a line is complete. Close
+// must be called to segment an unterminated last line; it does not close w.
+func NewSegmentingWriter(w io.Writer, f *Farasa, opts SegmentOptions) *SegmentingWriter {
+	return &SegmentingWriter{w: w, s: streamSegmenter{f: f, opts: opts}}
+}
+
+// Write segments the complete lines of p and whatever came before them
+func (sw *SegmentingWriter) Write(p []byte) (int, error) {
+	sw.s.feed(p, &sw.out)
+	if err := sw.drain(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close segments the rest of the text written so far
+func (sw *SegmentingWriter) Close() error {
+	sw.s.flush(&sw.out)
+	return sw.drain()
+}
+
+func (sw *SegmentingWriter) drain() error {
+	if sw.out.Len() == 0 {
+		return nil
+	}
+	_, err := sw.w.Write(sw.out.Bytes())
+	sw.out.Reset()
+	return err
+}
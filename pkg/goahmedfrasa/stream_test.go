@@ -0,0 +1,149 @@
+package goahmedfrasa
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// cliOutput segments text line by line in the format of the command line tool
+func cliOutput(f *Farasa, text string, opts SegmentOptions) string {
+	var out strings.Builder
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if line == "" {
+			continue
+		}
+		tokens, _ := f.SegmentWith(strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), opts)
+		for _, tok := range tokens {
+			out.WriteString(tok.Segmented + " ")
+		}
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// longLine returns a line of words of the corpus more than streamChunk bytes
+// long, separated by spaces or tabs
+func longLine(t *testing.T, sep string) string {
+	words := strings.Fields(strings.Join(testCorpus(t), " "))
+	var b strings.Builder
+	for i := 0; b.Len() <= 2*streamChunk; i++ {
+		if i > 0 {
+			b.WriteString(sep)
+		}
+		b.WriteString(words[i%len(words)])
+	}
+	return b.String()
+}
+
+func TestSegmentingReader(t *testing.T) {
+	f := newTestFarasa(t)
+	tests := []struct {
+		name, text string
+	}{
+		{"corpus", strings.Join(testCorpus(t), "\n") + "\n"},
+		{"unterminated last line", "والكتاب مشروب\r\nكتابه"},
+		{"long line", longLine(t, " ") + "\nكتابه\n"},
+		{"long line with tabs", longLine(t, "\t")},
+		{"long line without spaces", strings.Repeat("x", 2*streamChunk) + "\nكتابه\n"},
+	}
+	for _, tt := range tests {
+		want := cliOutput(f, tt.text, SegmentOptions{})
+		for _, r := range []struct {
+			name string
+			r    func(io.Reader) io.Reader
+		}{
+			{"", func(r io.Reader) io.Reader { return r }},
+			{"one byte at a time", iotest.OneByteReader},
+			{"half at a time", iotest.HalfReader},
+		} {
+			sr := NewSegmentingReader(r.r(strings.NewReader(tt.text)), f, SegmentOptions{})
+			got, err := io.ReadAll(sr)
+			if err != nil {
+				t.Fatalf("%s %s: %v", tt.name, r.name, err)
+			}
+			if string(got) != want {
+				t.Errorf("%s %s: got %d bytes differing from the %d of SegmentWith", tt.name, r.name, len(got), len(want))
+			}
+		}
+		// reads into small buffers
+		if err := iotest.TestReader(NewSegmentingReader(strings.NewReader(tt.text), f, SegmentOptions{}), []byte(want)); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+func TestSegmentingReaderError(t *testing.T) {
+	f := newTestFarasa(t)
+	errRead := errors.New("read failed")
+	text := "والكتاب مشروب\nكتابه"
+	sr := NewSegmentingReader(io.MultiReader(strings.NewReader(text), iotest.ErrReader(errRead)), f, SegmentOptions{})
+	got, err := io.ReadAll(sr)
+	if !errors.Is(err, errRead) {
+		t.Errorf("got error %v, want %v", err, errRead)
+	}
+	// the text read before the error comes first
+	if want := cliOutput(f, text, SegmentOptions{}); string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if n, err := sr.Read(make([]byte, 8)); n != 0 || !errors.Is(err, errRead) {
+		t.Errorf("read after the error: %d, %v", n, err)
+	}
+}
+
+func TestSegmentingWriter(t *testing.T) {
+	f := newTestFarasa(t)
+	opts := SegmentOptions{Scheme: "atb"}
+	for _, text := range []string{
+		strings.Join(testCorpus(t), "\n") + "\n",
+		longLine(t, " ") + "\nوالكتاب مشروب\r\nكتابه",
+	} {
+		want := cliOutput(f, text, opts)
+		for _, size := range []int{1, 7, len(text)} {
+			var out bytes.Buffer
+			sw := NewSegmentingWriter(&out, f, opts)
+			for p := []byte(text); len(p) > 0; {
+				n := min(size, len(p))
+				if m, err := sw.Write(p[:n]); m != n || err != nil {
+					t.Fatalf("Write: %d, %v", m, err)
+				}
+				p = p[n:]
+			}
+			// complete lines are written right away, the last one on Close
+			complete := text[:strings.LastIndexByte(text, '\n')+1]
+			if before := cliOutput(f, complete, opts); out.String() != before {
+				t.Errorf("writes of %d bytes: %d bytes before Close, want %d", size, out.Len(), len(before))
+			}
+			if err := sw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != want {
+				t.Errorf("writes of %d bytes: got %d bytes differing from the %d of SegmentWith", size, out.Len(), len(want))
+			}
+		}
+	}
+}
+
+// failingWriter fails every write
+type failingWriter struct{ err error }
+
+func (w failingWriter) Write([]byte) (int, error) { return 0, w.err }
+
+func TestSegmentingWriterError(t *testing.T) {
+	f := newTestFarasa(t)
+	errWrite := errors.New("write failed")
+	sw := NewSegmentingWriter(failingWriter{errWrite}, f, SegmentOptions{})
+	// nothing is written before a line is complete
+	if n, err := sw.Write([]byte("والكتاب")); n != len("والكتاب") || err != nil {
+		t.Errorf("Write of part of a line: %d, %v", n, err)
+	}
+	if n, err := sw.Write([]byte(" مشروب\nكتابه")); n != 0 || !errors.Is(err, errWrite) {
+		t.Errorf("Write of a line: %d, %v, want 0, %v", n, err, errWrite)
+	}
+	if err := sw.Close(); !errors.Is(err, errWrite) {
+		t.Errorf("Close: %v, want %v", err, errWrite)
+	}
+}
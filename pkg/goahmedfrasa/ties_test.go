@@ -0,0 +1,114 @@
+package goahmedfrasa
+
+import (
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestBetter(t *testing.T) {
+	tests := []struct {
+		a, b ScoredPartition
+		want bool
+	}{
+		// the score comes first, whatever the number of morphemes
+		{ScoredPartition{2, "\u0648+\u0627\u0644+;\u0643\u062a\u0627\u0628;"}, ScoredPartition{1, ";\u0648\u0627\u0644\u0643\u062a\u0627\u0628;"}, true},
+		{ScoredPartition{-1, ";\u0643\u062a\u0627\u0628;"}, ScoredPartition{0, "\u0643+;\u062a\u0627\u0628;"}, false},
+		// then fewer morphemes
+		{ScoredPartition{0, ";\u0643\u062a\u0627\u0628;"}, ScoredPartition{0, "\u0643+;\u062a\u0627\u0628;"}, true},
+		{ScoredPartition{0, "\u0628+;\u0643\u062a\u0627\u0628;+\u0647"}, ScoredPartition{0, "\u0628+;\u0643\u062a\u0627\u0628\u0647;"}, false},
+		// then the partition that sorts first bytewise
+		{ScoredPartition{0, "\u0628+;\u0643\u062a\u0627\u0628;"}, ScoredPartition{0, ";\u0628\u0643\u062a\u0627;+\u0628"}, false},
+		{ScoredPartition{0, ";\u0628\u0643\u062a\u0627;+\u0628"}, ScoredPartition{0, "\u0628+;\u0643\u062a\u0627\u0628;"}, true},
+		// nothing ranks above itself
+		{ScoredPartition{0, ";\u0643\u062a\u0627\u0628;"}, ScoredPartition{0, ";\u0643\u062a\u0627\u0628;"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.a.better(tt.b); got != tt.want {
+			t.Errorf("%v.better(%v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// TestMostLikelyPartitionTies checks that with zero weights, where every
+// candidate of a word scores the same, the ranking follows the tie rules and
+// not the order of the candidates
+func TestMostLikelyPartitionTies(t *testing.T) {
+	f := newTestFarasa(t, WithWeightsFile("../../testdata/zero-weights.txt"))
+	rng := rand.New(rand.NewSource(1))
+	for _, line := range testLines(t, "ties.txt") {
+		for _, word := range Tokenize(line) {
+			ranked := f.MostLikelyPartition(word, 1<<30)
+			for i := 1; i < len(ranked); i++ {
+				prev, cur := ranked[i-1], ranked[i]
+				if prev.score != cur.score {
+					t.Fatalf("%s: scores %v and %v differ with zero weights", word, prev.score, cur.score)
+				}
+				n, m := countMorphemes(prev.partition), countMorphemes(cur.partition)
+				if n < m || n == m && prev.partition <= cur.partition {
+					t.Errorf("%s: %s ranked below %s", word, prev.partition, cur.partition)
+				}
+			}
+
+			// the same candidates in another order rank the same
+			shuffled := append([]ScoredPartition(nil), ranked...)
+			rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+			sort.Slice(shuffled, func(i, j int) bool { return shuffled[j].better(shuffled[i]) })
+			for i := range ranked {
+				if shuffled[i] != ranked[i] {
+					t.Errorf("%s: shuffled candidates rank %s at %d, want %s", word, shuffled[i].partition, i, ranked[i].partition)
+					break
+				}
+			}
+		}
+	}
+}
+
+// TestTiesGolden segments testdata/ties.txt, words missing from SeenBefore,
+// with the default weights and with zero weights, where only the tie rules
+// decide. -update rewrites the golden files.
+func TestTiesGolden(t *testing.T) {
+	tests := []struct {
+		golden string
+		opts   []Option
+	}{
+		{"ties.golden", nil},
+		{"ties.zero.golden", []Option{WithWeightsFile("../../testdata/zero-weights.txt")}},
+	}
+	input := testLines(t, "ties.txt")
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			f := newTestFarasa(t, tt.opts...)
+			got := make([]string, len(input))
+			for i, line := range input {
+				tokens, _ := f.SegmentWith(line, SegmentOptions{NoNormalize: true})
+				got[i] = segmented(tokens)
+			}
+			if *update {
+				// as the command line tool prints them, every word followed by
+				// a space
+				var out strings.Builder
+				for _, line := range got {
+					for _, w := range strings.Fields(line) {
+						out.WriteString(w + " ")
+					}
+					out.WriteString("\n")
+				}
+				if err := os.WriteFile("../../testdata/"+tt.golden, []byte(out.String()), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want := testLines(t, tt.golden)
+			if len(want) != len(input) {
+				t.Fatalf("%d golden lines for %d input lines", len(want), len(input))
+			}
+			for i := range input {
+				if got[i] != strings.TrimSpace(want[i]) {
+					t.Errorf("line %d:\n got %s\nwant %s", i+1, got[i], want[i])
+				}
+			}
+		})
+	}
+}
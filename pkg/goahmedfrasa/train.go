@@ -0,0 +1,434 @@
+package goahmedfrasa
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Gold corpora hold one sentence per line with the morphemes of every word
+// joined by "+", which is what the command line tool prints with -n=false:
+//
+//	و+ال+كتاب ل+ال+مدرس+ة
+//
+// Arabic Treebank style corpora, where clitics are separate tokens such as
+// "ب+ المحكمة", are accepted too: a token ending in "+" is glued to the next
+// one and a token starting with "+" to the previous one.
+
+// TrainOptions controls Train. Every field is used as given; start from
+// DefaultTrainOptions to get the usual values.
+type TrainOptions struct {
+	// Epochs is the number of passes over the training words, at least 1
+	Epochs int
+	// HeldOut is the fraction of words kept aside to measure accuracy, in
+	// [0, 1). Zero trains on every word.
+	HeldOut float64
+	// LearningRate scales every update and must be positive
+	LearningRate float64
+	// Scheme is "" when the gold corpus uses the default Farasa scheme or "atb"
+	// when it uses the Arabic Treebank scheme
+	Scheme string
+	// Seed makes the split between training and held-out words and the order
+	// of the training words reproducible
+	Seed int64
+}
+
+// DefaultTrainOptions returns the options of the weights shipped with the
+// package: 10 epochs, 10% of the words held out and a learning rate of 0.01
+func DefaultTrainOptions() TrainOptions {
+	return TrainOptions{Epochs: 10, HeldOut: 0.1, LearningRate: 0.01}
+}
+
+// Validate reports the first option out of range, as Train does
+func (opts TrainOptions) Validate() error {
+	switch {
+	case opts.Epochs < 1:
+		return fmt.Errorf("epochs must be at least 1, got %d", opts.Epochs)
+	case !(opts.HeldOut >= 0 && opts.HeldOut < 1):
+		return fmt.Errorf("held-out fraction must be in [0, 1), got %g", opts.HeldOut)
+	case !(opts.LearningRate > 0) || math.IsInf(opts.LearningRate, 1):
+		return fmt.Errorf("learning rate must be positive, got %g", opts.LearningRate)
+	}
+	return nil
+}
+
+// TrainResult reports the outcome of Train
+type TrainResult struct {
+	// Weights are the averaged weights, ready for WriteWeights
+	Weights []float64
+	// Words is the number of gold words read
+	Words int
+	// Ambiguous is the number of gold words with more than one candidate
+	// partition. Only those are used for training and evaluation.
+	Ambiguous int
+	// Train and HeldOut are the numbers of ambiguous words in each split
+	Train   int
+	HeldOut int
+	// Reachable is the number of held-out words whose gold segmentation is
+	// among the candidates
+	Reachable int
+	// BaselineAccuracy and Accuracy are the fractions of held-out words whose
+	// best scoring candidate matches the gold segmentation, with the weights f
+	// was created with and with the trained weights
+	BaselineAccuracy float64
+	Accuracy         float64
+	// Temperature calibrates the probabilities of NBest for the trained
+	// weights on the held-out words, see Calibrate. It is 1 without held-out
+	// words.
+	Temperature float64
+}
+
+// errNoTrainingData is returned when the corpus holds no ambiguous word
+var errNoTrainingData = errors.New("no ambiguous words in the gold corpus")
+
+// trainingExample is a gold word along with its candidates and their
+// features. gold lists the indices of the candidates matching the gold
+// segmentation.
+type trainingExample struct {
+	word       string
+	candidates []string
+	features   []Features
+	gold       []int
+}
+
+// Train learns the weights of the scoring features from a gold segmented
+// corpus. For every gold word the candidates of MostLikelyPartition are
+// enumerated and an averaged perceptron is trained with a pairwise ranking
+// objective: whenever the best wrong candidate scores at least as high as the
+// best gold one, the weights move towards the features of the gold candidate
+// and away from those of the wrong one. Training starts from the weights f was
+// created with.
+func (f *Farasa) Train(gold io.Reader, opts TrainOptions) (*TrainResult, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	words, err := readGoldWords(gold)
+	if err != nil {
+		return nil, err
+	}
+	res := &TrainResult{Words: len(words)}
+
+	examples := f.trainingExamples(words, opts.Scheme)
+	res.Ambiguous = len(examples)
+	if len(examples) == 0 {
+		return nil, errNoTrainingData
+	}
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	rng.Shuffle(len(examples), func(i, j int) {
+		examples[i], examples[j] = examples[j], examples[i]
+	})
+	nHeldOut := 0
+	if opts.HeldOut > 0 {
+		nHeldOut = int(float64(len(examples))*opts.HeldOut + 0.5)
+		nHeldOut = min(max(nHeldOut, 1), len(examples)-1)
+	}
+	train, heldOut := examples[nHeldOut:], examples[:nHeldOut]
+	res.Train, res.HeldOut = len(train), len(heldOut)
+
+	w := f.Weights()
+	var sum [NumFeatures]float64
+	steps := 0
+	for epoch := 0; epoch < opts.Epochs; epoch++ {
+		rng.Shuffle(len(train), func(i, j int) {
+			train[i], train[j] = train[j], train[i]
+		})
+		for _, ex := range train {
+			if len(ex.gold) > 0 {
+				g, p := ex.rankingPair(w)
+				if p >= 0 && ex.features[p].Score(w) >= ex.features[g].Score(w) {
+					for k := range w {
+						w[k] += opts.LearningRate * (ex.features[g][k] - ex.features[p][k])
+					}
+				}
+			}
+			for k, v := range w {
+				sum[k] += v
+			}
+			steps++
+		}
+	}
+	res.Weights = make([]float64, NumFeatures)
+	for k := range sum {
+		res.Weights[k] = sum[k] / float64(steps)
+	}
+
+	res.Temperature = fitTemperature(heldOut, res.Weights)
+	if len(heldOut) > 0 {
+		var baseline, trained int
+		for _, ex := range heldOut {
+			if len(ex.gold) > 0 {
+				res.Reachable++
+			}
+			if ex.isGold(ex.best(f.weights)) {
+				baseline++
+			}
+			if ex.isGold(ex.best(res.Weights)) {
+				trained++
+			}
+		}
+		res.BaselineAccuracy = float64(baseline) / float64(len(heldOut))
+		res.Accuracy = float64(trained) / float64(len(heldOut))
+	}
+	return res, nil
+}
+
+// ExportFeatures writes the features of the candidates of every gold word in
+// SVM-light ranking format, for training rankers outside this package. Each
+// word is one query; every candidate becomes a line with target 1 if it matches
+// the gold segmentation and 0 otherwise, followed by the 18 feature values and
+// the word and partition as a comment:
+//
+//	1 qid:7 1:-1.386 2:-10 ... 18:-1 # والكتاب و+ال+;كتاب;
+//
+// Words with a single candidate or whose gold segmentation is not among the
+// candidates give no ranking pairs and are left out. scheme is as in
+// TrainOptions. It returns the number of queries written.
+func (f *Farasa) ExportFeatures(gold io.Reader, w io.Writer, scheme string) (int, error) {
+	words, err := readGoldWords(gold)
+	if err != nil {
+		return 0, err
+	}
+	bw := bufio.NewWriter(w)
+	qid := 0
+	for _, ex := range f.trainingExamples(words, scheme) {
+		if len(ex.gold) == 0 {
+			continue
+		}
+		qid++
+		for i, pp := range ex.candidates {
+			target := "0"
+			if ex.isGold(i) {
+				target = "1"
+			}
+			bw.WriteString(target)
+			bw.WriteString(" qid:")
+			bw.WriteString(strconv.Itoa(qid))
+			for k, v := range ex.features[i] {
+				bw.WriteString(" ")
+				bw.WriteString(strconv.Itoa(k + 1))
+				bw.WriteString(":")
+				bw.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+			}
+			bw.WriteString(" # ")
+			bw.WriteString(ex.word)
+			bw.WriteString(" ")
+			bw.WriteString(pp)
+			bw.WriteString("\n")
+		}
+	}
+	return qid, bw.Flush()
+}
+
+// Calibrate finds the temperature that makes the probabilities of NBest best
+// match a gold segmented corpus, by minimizing the negative log-likelihood of
+// the gold candidates under the weights of f. Pass the result to
+// WithTemperature. scheme is as in TrainOptions.
+func (f *Farasa) Calibrate(gold io.Reader, scheme string) (float64, error) {
+	words, err := readGoldWords(gold)
+	if err != nil {
+		return 0, err
+	}
+	examples := f.trainingExamples(words, scheme)
+	if len(examples) == 0 {
+		return 0, errNoTrainingData
+	}
+	return fitTemperature(examples, f.weights), nil
+}
+
+// fitTemperature returns the temperature minimizing the negative
+// log-likelihood of the gold candidates, found by golden section search over
+// log(T) in [-5, 5]. It returns 1 when no example has a gold candidate.
+func fitTemperature(examples []trainingExample, w []float64) float64 {
+	var scores [][]float64
+	var golds [][]int
+	for _, ex := range examples {
+		if len(ex.gold) == 0 {
+			continue
+		}
+		sc := make([]float64, len(ex.features))
+		for i := range ex.features {
+			sc[i] = ex.features[i].Score(w)
+		}
+		scores = append(scores, sc)
+		golds = append(golds, ex.gold)
+	}
+	if len(scores) == 0 {
+		return 1
+	}
+
+	nll := func(logT float64) float64 {
+		t := math.Exp(logT)
+		total := 0.0
+		for k, sc := range scores {
+			top := math.Inf(-1)
+			for _, s := range sc {
+				top = math.Max(top, s)
+			}
+			var all, gold float64
+			for _, s := range sc {
+				all += math.Exp((s - top) / t)
+			}
+			for _, g := range golds[k] {
+				gold += math.Exp((sc[g] - top) / t)
+			}
+			total -= math.Log(gold / all)
+		}
+		return total
+	}
+
+	invPhi := (math.Sqrt(5) - 1) / 2
+	lo, hi := -5.0, 5.0
+	a, b := hi-invPhi*(hi-lo), lo+invPhi*(hi-lo)
+	fa, fb := nll(a), nll(b)
+	for i := 0; i < 60; i++ {
+		if fa < fb {
+			hi, b, fb = b, a, fa
+			a = hi - invPhi*(hi-lo)
+			fa = nll(a)
+		} else {
+			lo, a, fa = a, b, fb
+			b = lo + invPhi*(hi-lo)
+			fb = nll(b)
+		}
+	}
+	return math.Exp((lo + hi) / 2)
+}
+
+// best returns the index of the candidate MostLikelyPartition would choose
+func (ex *trainingExample) best(w []float64) int {
+	best := 0
+	top := ScoredPartition{ex.features[0].Score(w), ex.candidates[0]}
+	for i := 1; i < len(ex.features); i++ {
+		if sp := (ScoredPartition{ex.features[i].Score(w), ex.candidates[i]}); sp.better(top) {
+			best, top = i, sp
+		}
+	}
+	return best
+}
+
+func (ex *trainingExample) isGold(i int) bool {
+	for _, g := range ex.gold {
+		if g == i {
+			return true
+		}
+	}
+	return false
+}
+
+// rankingPair returns the highest scoring gold candidate and the highest
+// scoring wrong one, or -1 for the latter when every candidate is gold
+func (ex *trainingExample) rankingPair(w []float64) (int, int) {
+	g, p := -1, -1
+	var gScore, pScore float64
+	for i := range ex.features {
+		sc := ex.features[i].Score(w)
+		if ex.isGold(i) {
+			if g < 0 || sc > gScore {
+				g, gScore = i, sc
+			}
+		} else if p < 0 || sc > pScore {
+			p, pScore = i, sc
+		}
+	}
+	return g, p
+}
+
+// trainingExamples computes the candidates and their features for every
+// ambiguous word, using all CPUs
+func (f *Farasa) trainingExamples(words []string, scheme string) []trainingExample {
+	examples := make([]*trainingExample, len(words))
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for n := 0; n < runtime.GOMAXPROCS(0); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				examples[i] = f.trainingExample(words[i], scheme)
+			}
+		}()
+	}
+	for i := range words {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	var out []trainingExample
+	for _, ex := range examples {
+		if ex != nil {
+			out = append(out, *ex)
+		}
+	}
+	return out
+}
+
+// trainingExample returns the example for a gold word, or nil when the word
+// has a single candidate
+func (f *Farasa) trainingExample(gold, scheme string) *trainingExample {
+	word := strings.ReplaceAll(gold, "+", "")
+	candidates := f.candidates(Buck2UTF8(word))
+	if len(candidates) < 2 {
+		return nil
+	}
+	want := NormalizeFull(gold)
+	ex := &trainingExample{word: word, candidates: candidates, features: make([]Features, len(candidates))}
+	for i, pp := range candidates {
+		ex.features[i] = f.PartitionFeatures(splitPartition(pp))
+		if f.renderCandidate(pp, scheme) == want {
+			ex.gold = append(ex.gold, i)
+		}
+	}
+	return ex
+}
+
+// renderCandidate formats a candidate partition like a normalized gold word
+func (f *Farasa) renderCandidate(pp, scheme string) string {
+	seg := cleanSegmentation(pp)
+	if scheme == "atb" {
+		out, _, _, _ := f.atbSegmentation(seg, true)
+		return strings.ReplaceAll(out, " ", "")
+	}
+	return NormalizeFull(seg)
+}
+
+// readGoldWords reads the words of a gold corpus, gluing split clitics back to
+// their words and removing diacritics
+func readGoldWords(r io.Reader) ([]string, error) {
+	var words []string
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		lineStart := len(words)
+		var pending string
+		for _, tok := range strings.Fields(RemoveDiacritics(line)) {
+			switch {
+			case strings.HasPrefix(tok, "+") && pending == "" && len(words) > lineStart:
+				words[len(words)-1] += tok
+			case strings.HasSuffix(tok, "+"):
+				pending += tok
+			default:
+				words = append(words, pending+tok)
+				pending = ""
+			}
+		}
+		if pending != "" {
+			words = append(words, strings.TrimSuffix(pending, "+"))
+		}
+		if err == io.EOF {
+			return words, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
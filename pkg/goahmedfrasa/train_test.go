@@ -0,0 +1,207 @@
+package goahmedfrasa
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestTrainOptionsValidate(t *testing.T) {
+	if err := DefaultTrainOptions().Validate(); err != nil {
+		t.Errorf("default options: %v", err)
+	}
+	for _, tt := range []struct {
+		name   string
+		modify func(*TrainOptions)
+		ok     bool
+	}{
+		{"no held-out words", func(o *TrainOptions) { o.HeldOut = 0 }, true},
+		{"one epoch", func(o *TrainOptions) { o.Epochs = 1 }, true},
+		{"zero epochs", func(o *TrainOptions) { o.Epochs = 0 }, false},
+		{"negative epochs", func(o *TrainOptions) { o.Epochs = -1 }, false},
+		{"negative held-out", func(o *TrainOptions) { o.HeldOut = -0.1 }, false},
+		{"all held out", func(o *TrainOptions) { o.HeldOut = 1 }, false},
+		{"NaN held-out", func(o *TrainOptions) { o.HeldOut = math.NaN() }, false},
+		{"zero rate", func(o *TrainOptions) { o.LearningRate = 0 }, false},
+		{"infinite rate", func(o *TrainOptions) { o.LearningRate = math.Inf(1) }, false},
+		{"zero value", func(o *TrainOptions) { *o = TrainOptions{} }, false},
+	} {
+		opts := DefaultTrainOptions()
+		tt.modify(&opts)
+		if err := opts.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: Validate() = %v", tt.name, err)
+		}
+	}
+}
+
+// trainingAccuracy returns the fraction of the words of testdata/gold.txt f
+// segments like the gold
+func trainingAccuracy(t *testing.T, f *Farasa) float64 {
+	t.Helper()
+	gold, err := os.Open("../../testdata/gold.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gold.Close()
+	res, err := f.Evaluate(context.Background(), gold, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.Accuracy
+}
+
+// TestTrainWithoutHeldOut trains on every word of the gold sample, which must
+// not segment worse with the trained weights
+func TestTrainWithoutHeldOut(t *testing.T) {
+	f := newTestFarasa(t, WithoutSeenBefore())
+	gold, err := os.Open("../../testdata/gold.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gold.Close()
+	opts := DefaultTrainOptions()
+	opts.HeldOut = 0
+	res, err := f.Train(gold, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.HeldOut != 0 || res.Train != res.Ambiguous {
+		t.Errorf("%d words for training and %d held out, want all %d for training", res.Train, res.HeldOut, res.Ambiguous)
+	}
+	for i, w := range res.Weights {
+		if math.IsNaN(w) || math.IsInf(w, 0) {
+			t.Errorf("weight %d is %v", i+1, w)
+		}
+	}
+
+	trained := newTestFarasa(t, WithoutSeenBefore(), WithWeights(res.Weights))
+	before, after := trainingAccuracy(t, f), trainingAccuracy(t, trained)
+	if after < before {
+		t.Errorf("accuracy on the training words %.4f with the trained weights, %.4f before", after, before)
+	}
+
+	opts.Epochs = -1
+	if _, err := f.Train(gold, opts); err == nil {
+		t.Error("negative epochs accepted")
+	}
+}
+
+// TestTrainHeldOut checks the accuracy Train reports on the held-out words
+func TestTrainHeldOut(t *testing.T) {
+	f := newTestFarasa(t, WithoutSeenBefore())
+	gold, err := os.Open("../../testdata/gold.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gold.Close()
+	opts := DefaultTrainOptions()
+	opts.HeldOut = 0.3
+	res, err := f.Train(gold, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.HeldOut == 0 || res.Train+res.HeldOut != res.Ambiguous || res.Reachable > res.HeldOut {
+		t.Errorf("%d training, %d held-out and %d reachable words of %d", res.Train, res.HeldOut, res.Reachable, res.Ambiguous)
+	}
+	if res.Accuracy < res.BaselineAccuracy {
+		t.Errorf("held-out accuracy %.4f with the trained weights, %.4f before", res.Accuracy, res.BaselineAccuracy)
+	}
+}
+
+// TestTrainWholeAverageStemLength trains with an average stem length that
+// stems have exactly, whose feature used to be log(0)
+func TestTrainWholeAverageStemLength(t *testing.T) {
+	f := newTestFarasa(t, WithoutSeenBefore(), WithGeneralVariables(map[string]float64{"averageStemLength": 4}))
+	x := f.PartitionFeatures(splitPartition("\u0648+\u0627\u0644+;\u0643\u062a\u0627\u0628;"))
+	if math.IsInf(x[12], 0) || math.IsNaN(x[12]) {
+		t.Fatalf("feature 12 of a stem of the average length is %v", x[12])
+	}
+	gold, err := os.Open("../../testdata/gold.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gold.Close()
+	res, err := f.Train(gold, DefaultTrainOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, w := range res.Weights {
+		if math.IsNaN(w) || math.IsInf(w, 0) {
+			t.Errorf("weight %d is %v", i+1, w)
+		}
+	}
+}
+
+// TestExportFeatures parses the SVM-light lines written for testdata/gold.txt
+func TestExportFeatures(t *testing.T) {
+	f := newTestFarasa(t)
+	gold, err := os.Open("../../testdata/gold.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gold.Close()
+	var buf bytes.Buffer
+	n, err := f.ExportFeatures(gold, &buf, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Fatal("no queries written")
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	qid, candidates, golds := 0, 0, 0
+	// endQuery checks the query ended by a new qid or the end of the output
+	endQuery := func() {
+		if qid > 0 && (candidates < 2 || golds == 0) {
+			t.Errorf("query %d: %d candidates, %d gold, want several and a gold one", qid, candidates, golds)
+		}
+	}
+	for _, line := range lines {
+		data, comment, ok := strings.Cut(line, " # ")
+		fields := strings.Fields(data)
+		word, partition, ok2 := strings.Cut(comment, " ")
+		if !ok || !ok2 || len(fields) != 2+NumFeatures {
+			t.Fatalf("malformed line %q", line)
+		}
+		if fields[0] != "0" && fields[0] != "1" {
+			t.Errorf("%q: target %s", line, fields[0])
+		}
+		q, err := strconv.Atoi(strings.TrimPrefix(fields[1], "qid:"))
+		if err != nil || !strings.HasPrefix(fields[1], "qid:") {
+			t.Fatalf("%q: bad qid %s", line, fields[1])
+		}
+		switch q {
+		case qid:
+		case qid + 1:
+			endQuery()
+			qid, candidates, golds = q, 0, 0
+		default:
+			t.Fatalf("%q: query %d after %d", line, q, qid)
+		}
+		candidates++
+		if fields[0] == "1" {
+			golds++
+		}
+
+		x := f.PartitionFeatures(splitPartition(partition))
+		for i, field := range fields[2:] {
+			idx, val, _ := strings.Cut(field, ":")
+			v, err := strconv.ParseFloat(val, 64)
+			if idx != strconv.Itoa(i+1) || err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+				t.Fatalf("%q: feature %d is %q", line, i+1, field)
+			}
+			if v != x[i] {
+				t.Errorf("%s %s: feature %d is %v, PartitionFeatures %v", word, partition, i+1, v, x[i])
+			}
+		}
+	}
+	endQuery()
+	if qid != n {
+		t.Errorf("%d queries written, ExportFeatures returned %d", qid, n)
+	}
+}
@@ -0,0 +1,122 @@
+package goahmedfrasa
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Weights files use the "index:weight" notation of SVM-rank and liblinear
+// models, with feature indices counted from 1:
+//
+//	1:-0.097825818 2:-0.03893654 ... 18:0.60355717
+//
+// Pairs may be spread over several lines and anything after a "#" is a
+// comment. Tokens without a colon are ignored, so the model files written by
+// svm_rank_learn load as they are. Missing features weigh 0, as svm_rank_learn
+// leaves out those it trained to 0, but no feature may appear twice.
+
+// NumFeatures is the number of features ScorePartition combines
+const NumFeatures = 18
+
+// magicNumbersStr holds the weights of the 18 scoring features trained on the
+// Arabic Treebank
+const magicNumbersStr = "1:-0.097825818 2:-0.03893654 3:0.13109569 4:0.18436976 5:0.11448806 6:0.53001714 7:0.21098258 8:-0.17760228 9:0.44223878 10:0.26183113 11:-0.05603376 12:0.055829503 13:-0.17745291 14:0.015865559 15:0.66909122 16:0.16948195 17:0.15397599 18:0.60355717"
+
+var defaultWeights = mustReadWeights(magicNumbersStr)
+
+// ErrBadWeights is returned when a weights file is malformed, gives a feature
+// twice or a feature index beyond NumFeatures
+var ErrBadWeights = errors.New("invalid weights")
+
+func mustReadWeights(s string) []float64 {
+	w, err := ReadWeights(strings.NewReader(s))
+	if err != nil {
+		panic(err)
+	}
+	return w
+}
+
+// DefaultWeights returns a copy of the built-in feature weights
+func DefaultWeights() []float64 {
+	return append([]float64(nil), defaultWeights...)
+}
+
+// ReadWeights parses feature weights in "index:weight" notation. Features
+// not given weigh 0.
+func ReadWeights(r io.Reader) ([]float64, error) {
+	weights := make([]float64, NumFeatures)
+	seen := make([]bool, NumFeatures)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := sc.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		for _, field := range strings.Fields(text) {
+			idx, val, ok := strings.Cut(field, ":")
+			if !ok {
+				continue
+			}
+			n, err := strconv.Atoi(idx)
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: bad feature index %q", ErrBadWeights, line, idx)
+			}
+			if n < 1 || n > NumFeatures {
+				return nil, fmt.Errorf("%w: line %d: feature index %d out of range 1-%d", ErrBadWeights, line, n, NumFeatures)
+			}
+			if seen[n-1] {
+				return nil, fmt.Errorf("%w: line %d: feature %d given twice", ErrBadWeights, line, n)
+			}
+			w, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: bad weight for feature %d: %q", ErrBadWeights, line, n, val)
+			}
+			weights[n-1] = w
+			seen[n-1] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return weights, nil
+}
+
+// LoadWeights reads a weights file written by WriteWeights or svm_rank_learn
+func LoadWeights(path string) ([]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	w, err := ReadWeights(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return w, nil
+}
+
+// WriteWeights writes weights on a single line in "index:weight" notation
+func WriteWeights(w io.Writer, weights []float64) error {
+	if len(weights) != NumFeatures {
+		return fmt.Errorf("%w: expected %d weights, got %d", ErrBadWeights, NumFeatures, len(weights))
+	}
+	parts := make([]string, len(weights))
+	for i, v := range weights {
+		parts[i] = strconv.Itoa(i+1) + ":" + strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	_, err := fmt.Fprintln(w, strings.Join(parts, " "))
+	return err
+}
+
+// Weights returns a copy of the feature weights used by f
+func (f *Farasa) Weights() []float64 {
+	return append([]float64(nil), f.weights...)
+}
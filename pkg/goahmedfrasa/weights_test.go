@@ -0,0 +1,71 @@
+package goahmedfrasa
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadWeights(t *testing.T) {
+	// weights returns NumFeatures weights with the given index:weight pairs
+	weights := func(pairs map[int]float64) []float64 {
+		w := make([]float64, NumFeatures)
+		for i, v := range pairs {
+			w[i-1] = v
+		}
+		return w
+	}
+	tests := []struct {
+		name, input string
+		want        []float64
+	}{
+		{"empty", "", weights(nil)},
+		{"one feature", "6:0.5", weights(map[int]float64{6: 0.5})},
+		{"svm_rank_learn model", "SVM-light Version V6.20\n0 # kernel type\n3 # number of base features\n1 1:-0.25 3:1.5 18:2 #\n", weights(map[int]float64{1: -0.25, 3: 1.5, 18: 2})},
+		{"several lines", "2:1 # second\n\n17:-1e-3\r\n", weights(map[int]float64{2: 1, 17: -1e-3})},
+		{"zero weights file", "1:0 2:0 3:0 4:0 5:0 6:0 7:0 8:0 9:0 10:0 11:0 12:0 13:0 14:0 15:0 16:0 17:0 18:0", weights(nil)},
+	}
+	for _, tt := range tests {
+		got, err := ReadWeights(strings.NewReader(tt.input))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{
+		"1:1 1:2",
+		"3:1\n3:1",
+		"0:1",
+		"19:1",
+		"-1:1",
+		"x:1",
+		"2:heavy",
+	} {
+		if w, err := ReadWeights(strings.NewReader(input)); !errors.Is(err, ErrBadWeights) {
+			t.Errorf("%q: %v, %v, want %v", input, w, err, ErrBadWeights)
+		}
+	}
+}
+
+func TestWriteWeights(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteWeights(&buf, DefaultWeights()); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadWeights(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, DefaultWeights()) {
+		t.Errorf("read back %v, want %v", got, DefaultWeights())
+	}
+	if err := WriteWeights(&buf, make([]float64, NumFeatures-1)); !errors.Is(err, ErrBadWeights) {
+		t.Errorf("%d weights: %v, want %v", NumFeatures-1, err, ErrBadWeights)
+	}
+}